@@ -6,7 +6,13 @@ import (
 )
 
 const (
-	THROW_CARD = "throw_card"
+	THROW_CARD      = "throw_card"
+	INITIAL_ESCOBA  = "initial_escoba"
+	DECLARE_VICTORY = "declare_victory"
+	RESIGN          = "resign"
+	OFFER_DRAW      = "offer_draw"
+	ACCEPT_DRAW     = "accept_draw"
+	DECLINE_DRAW    = "decline_draw"
 )
 
 type act struct {
@@ -37,6 +43,11 @@ func newActionThrowCard(card Card, capturedTableCards []Card) Action {
 }
 
 func (a ActionThrowCard) IsPossible(g GameState) bool {
+	return a.Check(g) == nil
+}
+
+// Check returns nil if the action is possible, or else an *ActionError explaining why not.
+func (a ActionThrowCard) Check(g GameState) error {
 	// Check if player has this card
 	hasCard := false
 	for _, card := range g.Hands[g.TurnPlayerID].Cards {
@@ -46,24 +57,16 @@ func (a ActionThrowCard) IsPossible(g GameState) bool {
 		}
 	}
 	if !hasCard {
-		return false
+		return newActionError(ACTION_ERROR_CARD_NOT_IN_HAND, "%v is not in player %d's hand", a.Card, g.TurnPlayerID)
 	}
 
 	// Check if the captured table cards are valid
 	if len(a.CapturedTableCards) == 0 {
-		// This is a simple throw - valid only if no combinations are possible
-		return len(g.findAllValidCombinations(a.Card, g.TableCards)) == 0
-	}
-
-	// Check if this specific combination is valid
-	expectedSum := 15 - a.Card.GetEscobaValue()
-	actualSum := 0
-	for _, tableCard := range a.CapturedTableCards {
-		actualSum += tableCard.GetEscobaValue()
-	}
-
-	if actualSum != expectedSum {
-		return false
+		// This is a simple throw - valid only if capturing is optional or no combinations are possible
+		if !g.rules().OptionalCapture && g.canCapture(a.Card) {
+			return newActionError(ACTION_ERROR_CAPTURE_IS_MANDATORY, "%v can capture from the table", a.Card)
+		}
+		return nil
 	}
 
 	// Check if all captured cards are actually on the table
@@ -81,15 +84,34 @@ func (a ActionThrowCard) IsPossible(g GameState) bool {
 			}
 		}
 		if !found {
-			return false
+			return newActionError(ACTION_ERROR_CARD_NOT_ON_TABLE, "%v is not on the table", capturedCard)
 		}
 	}
 
-	return true
+	// Check if this specific combination is valid
+	expectedSum := g.rules().CaptureSum - a.Card.GetEscobaValue()
+	if g.isScopa() {
+		// In Scopa, a single matching card must be taken before any combination
+		expectedSum = a.Card.GetEscobaValue()
+		if len(a.CapturedTableCards) > 1 && hasCardWithValue(g.TableCards, expectedSum) {
+			return newActionError(ACTION_ERROR_MATCHING_CARD_FIRST, "a card worth %d is on the table", expectedSum)
+		}
+	}
+	actualSum := 0
+	for _, tableCard := range a.CapturedTableCards {
+		actualSum += tableCard.GetEscobaValue()
+	}
+
+	if actualSum != expectedSum {
+		return newActionError(ACTION_ERROR_WRONG_SUM, "captured cards add up to %d, but %v needs %d", actualSum, a.Card, expectedSum)
+	}
+
+	return nil
 }
 
 func (a ActionThrowCard) Run(g *GameState) error {
 	playerID := g.TurnPlayerID
+	countsAsEscoba := g.clearingCountsAsEscoba()
 
 	// Remove card from player's hand
 	for i, card := range g.Hands[playerID].Cards {
@@ -101,23 +123,26 @@ func (a ActionThrowCard) Run(g *GameState) error {
 
 	if len(a.CapturedTableCards) > 0 {
 		// Capture the combination
-		cardsToCapture := make([]Card, 0, len(a.CapturedTableCards)+1)
-		cardsToCapture = append(cardsToCapture, a.CapturedTableCards...)
-		cardsToCapture = append(cardsToCapture, a.Card)
-		g.Piles[playerID] = append(g.Piles[playerID], cardsToCapture...)
+		g.Piles[playerID] = append(append(g.Piles[playerID], a.CapturedTableCards...), a.Card)
 
 		// Remove captured cards from table
-		g.TableCards = g.removeCardsFromTable(g.TableCards, cardsToCapture)
+		g.TableCards = g.removeCardsFromTable(g.TableCards, a.CapturedTableCards)
 
 		g.LastCapturerPlayerID = playerID
+		g.emit(EVENT_CAPTURE, playerID, func(e *Event) {
+			e.Card = &a.Card
+			e.Cards = append([]Card{}, a.CapturedTableCards...)
+		})
 
 		// Check if this is an escoba (table was cleared)
-		if len(g.TableCards) == 0 && len(a.CapturedTableCards) > 0 {
+		if len(g.TableCards) == 0 && len(a.CapturedTableCards) > 0 && countsAsEscoba {
 			g.Escobas[playerID]++
+			g.emit(EVENT_ESCOBA, playerID, nil)
 		}
 	} else {
 		// No combination, card goes to table
-		g.TableCards = append(g.TableCards, a.Card)
+		g.TableCards = insertCard(g.TableCards, a.Card)
+		g.emit(EVENT_CARD_THROWN, playerID, func(e *Event) { e.Card = &a.Card })
 	}
 
 	return nil
@@ -162,7 +187,34 @@ func (a ActionThrowCard) IsEscoba(g *GameState) bool {
 	// The number of cards on the table before this move is len(g.TableCards).
 	// The number of cards we capture from the table is len(a.CapturedTableCards).
 	// If they are equal and greater than 0, it's an escoba.
-	return a.IsCapture() && len(g.TableCards) == len(a.CapturedTableCards)
+	return a.IsCapture() && len(g.TableCards) == len(a.CapturedTableCards) && g.clearingCountsAsEscoba()
+}
+
+// clearingCountsAsEscoba returns true if clearing the table with the card about
+// to be thrown is an escoba, which is not the case for the last card of the set
+// under Rules.LastCaptureNotEscoba.
+func (g *GameState) clearingCountsAsEscoba() bool {
+	return !g.rules().LastCaptureNotEscoba || !g.isLastThrowOfSet()
+}
+
+// isLastThrowOfSet returns true if the card about to be thrown is the last one
+// of the set: there are no cards left to deal, and it's the last card in hand.
+//
+// It only looks at public information, so it works on a player's view too.
+func (g *GameState) isLastThrowOfSet() bool {
+	if g.DeckCount >= g.rules().Players*g.rules().HandSize {
+		return false
+	}
+	for _, playerID := range g.PlayerIDs() {
+		cardsLeft := 0
+		if playerID == g.TurnPlayerID {
+			cardsLeft = 1
+		}
+		if hand := g.Hands[playerID]; hand != nil && hand.Len() > cardsLeft {
+			return false
+		}
+	}
+	return true
 }
 
 func (a ActionThrowCard) CardSetentaSum() int {
@@ -176,6 +228,10 @@ func (a ActionThrowCard) CardSetentaSum() int {
 	return sum
 }
 
+func (a ActionThrowCard) appendJSON(dst []byte) []byte {
+	return appendThrowCardJSON(dst, a.Card, a.CapturedTableCards)
+}
+
 func (a ActionThrowCard) String() string {
 	if len(a.CapturedTableCards) == 0 {
 		return fmt.Sprintf("throw %s to table", a.Card.String())
@@ -193,13 +249,266 @@ func (a ActionThrowCard) String() string {
 	return fmt.Sprintf("throw %s and capture %s", a.Card.String(), captured)
 }
 
-// findAllValidCombinations finds all possible combinations of table cards that sum to (15 - thrownCardValue)
-func findAllValidCombinations(thrownCard Card, tableCards []Card) [][]Card {
-	targetSum := 15
+// ActionInitialEscoba records an escoba on the deal: the initial table cards summing
+// to Rules.CaptureSum (or twice that) are swept by PlayerID (see Rules.InitialEscoba).
+//
+// The engine runs it while dealing and records it in GameState.Actions so that
+// clients can show it; it's never possible for a player to run it.
+type ActionInitialEscoba struct {
+	act
+	PlayerID int    `json:"playerID"`
+	Cards    []Card `json:"cards"`
+	Escobas  int    `json:"escobas"`
+}
+
+func newActionInitialEscoba(playerID int, cards []Card, escobas int) Action {
+	return ActionInitialEscoba{
+		act:      act{Name: INITIAL_ESCOBA},
+		PlayerID: playerID,
+		Cards:    append([]Card{}, cards...),
+		Escobas:  escobas,
+	}
+}
+
+func (a ActionInitialEscoba) IsPossible(g GameState) bool {
+	return false
+}
+
+func (a ActionInitialEscoba) Run(g *GameState) error {
+	g.Piles[a.PlayerID] = append(g.Piles[a.PlayerID], a.Cards...)
+	g.Escobas[a.PlayerID] += a.Escobas
+	g.LastCapturerPlayerID = a.PlayerID // Track the sweeper as last capturer
+	g.TableCards = []Card{}
+	return nil
+}
+
+func (a ActionInitialEscoba) YieldsTurn(g GameState) bool {
+	return false
+}
+
+func (a ActionInitialEscoba) String() string {
+	captured := "["
+	for i, card := range a.Cards {
+		if i > 0 {
+			captured += ", "
+		}
+		captured += card.String()
+	}
+	captured += "]"
+
+	return fmt.Sprintf("player %d sweeps %s on the deal (%d escobas)", a.PlayerID, captured, a.Escobas)
+}
+
+// ActionDeclareVictory claims the win during a set (see Rules.VictoryClaims). If
+// the player's ProvisionalScore reaches Rules.TargetScore, they win the game right
+// away. Otherwise, the claim is false: they lose Rules.FalseClaimPenalty points,
+// even if their score goes below zero, and must still play their turn. A player
+// may claim the win only once per turn.
+type ActionDeclareVictory struct {
+	act
+}
+
+func newActionDeclareVictory() Action {
+	return ActionDeclareVictory{act: act{Name: DECLARE_VICTORY}}
+}
+
+func (a ActionDeclareVictory) IsPossible(g GameState) bool {
+	return g.rules().VictoryClaims && !g.IsEnded && !g.hasClaimedThisTurn()
+}
+
+func (a ActionDeclareVictory) Run(g *GameState) error {
+	sideID := g.sideOf(g.TurnPlayerID)
+	if score := g.ProvisionalScore(g.TurnPlayerID); score >= g.rules().TargetScore {
+		g.Scores[sideID] = score
+		g.endGame(sideID, END_REASON_VICTORY_CLAIM)
+		return nil
+	}
+
+	// A false claim always costs the full penalty, so that it's never free
+	g.Scores[sideID] -= g.rules().FalseClaimPenalty
+	g.Penalties[sideID] += g.rules().FalseClaimPenalty
+	return nil
+}
+
+func (a ActionDeclareVictory) YieldsTurn(g GameState) bool {
+	return false
+}
+
+func (a ActionDeclareVictory) appendJSON(dst []byte) []byte {
+	return append(dst, `{"name":"`+DECLARE_VICTORY+`"}`...)
+}
+
+func (a ActionDeclareVictory) String() string {
+	return "declare victory"
+}
+
+// hasClaimedThisTurn returns true if the turn player has claimed the win since
+// their turn started
+func (g GameState) hasClaimedThisTurn() bool {
+	for i := len(g.Actions) - 1; i >= 0 && i < len(g.ActionOwnerPlayerIDs); i-- {
+		action, err := DeserializeAction(g.Actions[i])
+		if err != nil {
+			return false
+		}
+		switch action.GetName() {
+		case DECLARE_VICTORY:
+			if g.ActionOwnerPlayerIDs[i] == g.TurnPlayerID {
+				return true
+			}
+		case THROW_CARD, INITIAL_ESCOBA:
+			return false
+		}
+	}
+	return false
+}
+
+// playerAct is embedded by the actions that any player may run, even out of
+// turn. They carry the ID of the player who runs them.
+type playerAct struct {
+	act
+	PlayerID int `json:"playerID"`
+}
+
+func (a playerAct) GetPlayerID() int {
+	return a.PlayerID
+}
+
+func (a playerAct) YieldsTurn(g GameState) bool {
+	return false
+}
+
+// appendJSON serializes the action, which must have no fields besides those of playerAct
+func (a playerAct) appendJSON(dst []byte) []byte {
+	return appendPlayerActJSON(dst, a.Name, a.PlayerID)
+}
+
+// isSeated returns true if the action's player is playing a game that hasn't ended
+func (a playerAct) isSeated(g GameState) bool {
+	return !g.IsEnded && a.PlayerID >= 0 && a.PlayerID < g.rules().Players
+}
+
+// ActionResign concedes the game: the other side wins. With more than two
+// sides, the highest score among the others wins (a tie for it is a draw).
+type ActionResign struct {
+	playerAct
+}
+
+func newActionResign(playerID int) Action {
+	return ActionResign{playerAct{act: act{Name: RESIGN}, PlayerID: playerID}}
+}
+
+func (a ActionResign) IsPossible(g GameState) bool {
+	return a.isSeated(g)
+}
+
+func (a ActionResign) Run(g *GameState) error {
+	resignedID := g.sideOf(a.PlayerID)
+	others := map[int]int{}
+	for _, sideID := range g.sideIDs() {
+		if sideID != resignedID {
+			others[sideID] = g.Scores[sideID]
+		}
+	}
+	g.endGame(uniqueMaxID(others), END_REASON_RESIGNATION)
+	return nil
+}
+
+func (a ActionResign) String() string {
+	return fmt.Sprintf("player %d resigns", a.PlayerID)
+}
+
+// ActionOfferDraw offers a draw to the other sides, which they may accept or
+// decline. The offer is withdrawn when a player of another side throws a card.
+type ActionOfferDraw struct {
+	playerAct
+}
+
+func newActionOfferDraw(playerID int) Action {
+	return ActionOfferDraw{playerAct{act: act{Name: OFFER_DRAW}, PlayerID: playerID}}
+}
+
+func (a ActionOfferDraw) IsPossible(g GameState) bool {
+	return a.isSeated(g) && len(g.DrawOfferSideIDs) == 0
+}
+
+func (a ActionOfferDraw) Run(g *GameState) error {
+	g.DrawOfferSideIDs = []int{g.sideOf(a.PlayerID)}
+	return nil
+}
+
+func (a ActionOfferDraw) String() string {
+	return fmt.Sprintf("player %d offers a draw", a.PlayerID)
+}
+
+// ActionAcceptDraw accepts the draw on offer. The game ends in a draw once every
+// side has accepted it.
+type ActionAcceptDraw struct {
+	playerAct
+}
+
+func newActionAcceptDraw(playerID int) Action {
+	return ActionAcceptDraw{playerAct{act: act{Name: ACCEPT_DRAW}, PlayerID: playerID}}
+}
+
+func (a ActionAcceptDraw) IsPossible(g GameState) bool {
+	return a.isSeated(g) && len(g.DrawOfferSideIDs) > 0 && !slices.Contains(g.DrawOfferSideIDs, g.sideOf(a.PlayerID))
+}
+
+func (a ActionAcceptDraw) Run(g *GameState) error {
+	g.DrawOfferSideIDs = append(g.DrawOfferSideIDs, g.sideOf(a.PlayerID))
+	if len(g.DrawOfferSideIDs) == len(g.sideIDs()) {
+		g.endGame(-1, END_REASON_DRAW_AGREED)
+	}
+	return nil
+}
+
+func (a ActionAcceptDraw) String() string {
+	return fmt.Sprintf("player %d accepts the draw", a.PlayerID)
+}
+
+// ActionDeclineDraw declines the draw on offer, which is withdrawn.
+type ActionDeclineDraw struct {
+	playerAct
+}
+
+func newActionDeclineDraw(playerID int) Action {
+	return ActionDeclineDraw{playerAct{act: act{Name: DECLINE_DRAW}, PlayerID: playerID}}
+}
+
+func (a ActionDeclineDraw) IsPossible(g GameState) bool {
+	return newActionAcceptDraw(a.PlayerID).IsPossible(g)
+}
+
+func (a ActionDeclineDraw) Run(g *GameState) error {
+	g.DrawOfferSideIDs = []int{}
+	return nil
+}
+
+func (a ActionDeclineDraw) String() string {
+	return fmt.Sprintf("player %d declines the draw", a.PlayerID)
+}
+
+// actionOwnerID returns the player who runs the action: the one it names, for
+// actions that may be run out of turn, or else the player whose turn it is.
+func (g GameState) actionOwnerID(action Action) int {
+	if a, ok := action.(interface{ GetPlayerID() int }); ok {
+		return a.GetPlayerID()
+	}
+	return g.TurnPlayerID
+}
+
+// isEngineAction returns true if the serialized action was run by the engine rather than by a player
+func isEngineAction(bs []byte) bool {
+	action, err := DeserializeAction(bs)
+	return err == nil && action.GetName() == INITIAL_ESCOBA
+}
+
+// findAllCombinationsSummingTo finds all possible combinations of table cards that sum to (targetSum - thrownCardValue)
+func findAllCombinationsSummingTo(targetSum int, thrownCard Card, tableCards []Card) [][]Card {
 	thrownValue := thrownCard.GetEscobaValue()
 
 	if thrownValue >= targetSum {
-		return [][]Card{} // Card value too high to make 15
+		return [][]Card{} // Card value too high to make targetSum
 	}
 
 	remainingSum := targetSum - thrownValue
@@ -242,29 +551,72 @@ func findCombinationsDFS(tableCards []Card, targetSum int, currentCombination []
 	}
 }
 
-// Update the GameState method to use the standalone function
-func (g *GameState) findAllValidCombinations(thrownCard Card, tableCards []Card) [][]Card {
-	return findAllValidCombinations(thrownCard, tableCards)
-}
+// findAllScopaCombinations finds all combinations of table cards that thrownCard can capture in Scopa:
+// each single card of the same value or, if there are none, every combination that sums to its value
+func findAllScopaCombinations(thrownCard Card, tableCards []Card) [][]Card {
+	thrownValue := thrownCard.GetEscobaValue()
 
-// removeCardsFromTable removes the specified cards from the table
-func (g *GameState) removeCardsFromTable(tableCards []Card, toRemove []Card) []Card {
-	// Create set from tableCards
-	tableSet := make(map[Card]struct{})
+	allCombinations := [][]Card{}
 	for _, card := range tableCards {
-		tableSet[card] = struct{}{}
+		if card.GetEscobaValue() == thrownValue {
+			allCombinations = append(allCombinations, []Card{card})
+		}
+	}
+	if len(allCombinations) > 0 {
+		return allCombinations
+	}
+
+	findCombinationsDFS(tableCards, thrownValue, []Card{}, 0, &allCombinations)
+	return allCombinations
+}
+
+func hasCardWithValue(cards []Card, value int) bool {
+	for _, card := range cards {
+		if card.GetEscobaValue() == value {
+			return true
+		}
 	}
+	return false
+}
 
-	// Remove cards that are in toRemove
-	for _, card := range toRemove {
-		delete(tableSet, card)
+// findAllValidCombinations finds all combinations of table cards that thrownCard can capture under the game's rules.
+// The combinations and their cards are in canonical order (see Card.Index).
+func (g *GameState) findAllValidCombinations(thrownCard Card, tableCards []Card) [][]Card {
+	tableCards = sortedCards(tableCards)
+	if g.isScopa() {
+		return findAllScopaCombinations(thrownCard, tableCards)
 	}
+	return findAllCombinationsSummingTo(g.rules().CaptureSum, thrownCard, tableCards)
+}
 
-	// Convert back to slice
-	result := make([]Card, 0, len(tableSet))
-	for card := range tableSet {
-		result = append(result, card)
+// findAllThrows returns the throws that the player whose turn it is may play, in
+// the same order as appendMoves, but working on the cards themselves. It's for
+// hands and tables that aren't sets of cards (see isCardSet), e.g. set up by hand
+// with duplicates or cards that aren't Spanish.
+func (g *GameState) findAllThrows() []Action {
+	hand := sortedCards(g.Hands[g.TurnPlayerID].Cards)
+	var throws []Action
+	for _, card := range hand {
+		for _, combination := range g.findAllValidCombinations(card, g.TableCards) {
+			throws = append(throws, newActionThrowCard(card, combination))
+		}
+	}
+	if len(throws) == 0 || g.rules().OptionalCapture {
+		for _, card := range hand {
+			throws = append(throws, newActionThrowCard(card, []Card{}))
+		}
 	}
+	return throws
+}
 
+// removeCardsFromTable removes the specified cards from the table, keeping the
+// order of the remaining ones
+func (g *GameState) removeCardsFromTable(tableCards []Card, toRemove []Card) []Card {
+	result := make([]Card, 0, len(tableCards))
+	for _, card := range tableCards {
+		if !slices.Contains(toRemove, card) {
+			result = append(result, card)
+		}
+	}
 	return result
 }
@@ -27,6 +27,13 @@ func (b *SimpleBot) ChooseAction(gameState GameState) Action {
 		return actions[0]
 	}
 
+	// Claim the win when it's a rightful claim
+	for _, action := range actions {
+		if action.GetName() == DECLARE_VICTORY && gameState.ProvisionalScore(gameState.TurnPlayerID) >= gameState.rules().TargetScore {
+			return action
+		}
+	}
+
 	throwActions := make([]ActionThrowCard, 0)
 	for _, action := range actions {
 		if action.GetName() == THROW_CARD {
@@ -58,13 +65,46 @@ func (b *SimpleBot) ChooseAction(gameState GameState) Action {
 			return hasSieteI
 		}
 
-		// 3.
+		// 3. if capturing is optional, between a capture and a throw, the one that doesn't
+		// let the opponent clear the table with a single card is priority 3
+		if gameState.rules().OptionalCapture && actionI.IsCapture() != actionJ.IsCapture() {
+			opensEscobaI := opensEscoba(actionI, gameState)
+			opensEscobaJ := opensEscoba(actionJ, gameState)
+			if opensEscobaI != opensEscobaJ {
+				return !opensEscobaI
+			}
+		}
+
+		// 4.
 		return isLeftBetterThanRight(actionI, actionJ, gameState)
 	})
 
 	return throwActions[0]
 }
 
+// highestCardValue is the escoba value of the highest card (12 = 10)
+const highestCardValue = 10
+
+// opensEscoba returns true if, after the action, the next player could clear the
+// table with a single card. When capturing is optional, throwing a card to the
+// table instead of capturing can be the way to avoid this.
+func opensEscoba(action ActionThrowCard, gameState GameState) bool {
+	if action.IsEscoba(&gameState) {
+		return false
+	}
+	tableSum := gameState.sumCards(gameState.TableCards)
+	if action.IsCapture() {
+		tableSum -= gameState.sumCards(action.CapturedTableCards)
+	} else {
+		tableSum += action.Card.GetEscobaValue()
+	}
+	missing := gameState.rules().CaptureSum - tableSum
+	if gameState.isScopa() {
+		missing = tableSum
+	}
+	return missing >= 1 && missing <= highestCardValue
+}
+
 func isLeftBetterThanRight(left ActionThrowCard, right ActionThrowCard, gameState GameState) bool {
 	scoreLeft := caresAboutCardCount(gameState)*leftHasMoreCards(left, right) + caresAboutOroCount(gameState)*leftHasMoreOros(left, right) + caresAboutSetenta(gameState)*leftHasMoreSetenta(left, right)
 	scoreRight := caresAboutCardCount(gameState)*leftHasMoreCards(right, left) + caresAboutOroCount(gameState)*leftHasMoreOros(right, left) + caresAboutSetenta(gameState)*leftHasMoreSetenta(right, left)
@@ -96,27 +136,33 @@ func setentaPotential(action ActionThrowCard) int {
 	return action.CardSetentaSum()
 }
 
+// caresAboutCardCount returns 0 once the side of the player whose turn it is has
+// the most cards point secured
 func caresAboutCardCount(gameState GameState) int {
-	if cardCount(gameState) > 20 {
+	if cardCount(gameState, gameState.sideOf(gameState.TurnPlayerID)) > 20 {
 		return 0
 	}
 	return 1
 }
 
-func cardCount(gameState GameState) int {
-	return len(gameState.Piles[1])
+// cardCount returns the number of cards that sideID captured
+func cardCount(gameState GameState, sideID int) int {
+	return len(sidePile(gameState, sideID))
 }
 
+// caresAboutOroCount returns 0 once the side of the player whose turn it is has
+// the most oro cards point secured
 func caresAboutOroCount(gameState GameState) int {
-	if oroCount(gameState) > 5 {
+	if oroCount(gameState, gameState.sideOf(gameState.TurnPlayerID)) > 5 {
 		return 0
 	}
 	return 1
 }
 
-func oroCount(gameState GameState) int {
+// oroCount returns the number of oro cards that sideID captured
+func oroCount(gameState GameState, sideID int) int {
 	count := 0
-	for _, card := range gameState.Piles[1] {
+	for _, card := range sidePile(gameState, sideID) {
 		if card.Suit == ORO {
 			count++
 		}
@@ -124,13 +170,33 @@ func oroCount(gameState GameState) int {
 	return count
 }
 
+// caresAboutSetenta returns 0 once the la setenta score of the side of the player
+// whose turn it is gets above 22
 func caresAboutSetenta(gameState GameState) int {
-	if laSetentaScore(gameState) > 22 {
+	if laSetentaScore(gameState, gameState.sideOf(gameState.TurnPlayerID)) > 22 {
 		return 0
 	}
 	return 1
 }
 
-func laSetentaScore(gameState GameState) int {
-	return gameState.calculateSetenta(1)
+// laSetentaScore returns the la setenta score of sideID's cards
+func laSetentaScore(gameState GameState, sideID int) int {
+	if gameState.isScopa() {
+		// The primiera of a full hand is roughly three times la setenta
+		return primieraScore(sidePile(gameState, sideID)) / 3
+	}
+	return setentaScore(sidePile(gameState, sideID))
+}
+
+// sidePile returns the cards that sideID captured: a player's pile or, in team
+// mode, the piles of the team's players. The bot evaluates the side of the player
+// whose turn it is, so it plays the same from any seat.
+func sidePile(gameState GameState, sideID int) []Card {
+	var cards []Card
+	for _, playerID := range gameState.PlayerIDs() {
+		if gameState.sideOf(playerID) == sideID {
+			cards = append(cards, gameState.Piles[playerID]...)
+		}
+	}
+	return cards
 }
@@ -0,0 +1,256 @@
+package escoba
+
+import (
+	"encoding/json"
+	"math/bits"
+	"strconv"
+)
+
+// cardSet is a set of Spanish cards, with bit i set for the card whose Index is i.
+//
+// The engine uses it to generate moves without allocating: a capture is just the
+// set of table cards it takes, and its cards come out in canonical order.
+type cardSet uint64
+
+var (
+	// cardsByIndex is the card with each Index
+	cardsByIndex [deckSize]Card
+
+	// cardValues is the escoba value of the card with each Index
+	cardValues [deckSize]int
+
+	// cardJSON is the JSON encoding of the card with each Index
+	cardJSON [deckSize][]byte
+)
+
+func init() {
+	for i, card := range SpanishCards() {
+		cardsByIndex[i] = card
+		cardValues[i] = card.GetEscobaValue()
+		cardJSON[i], _ = json.Marshal(card)
+	}
+}
+
+// cardSetOf returns the set of the given cards. Cards that aren't in a Spanish deck are left out.
+func cardSetOf(cards []Card) cardSet {
+	var s cardSet
+	for _, card := range cards {
+		if i := card.Index(); i != -1 {
+			s |= 1 << i
+		}
+	}
+	return s
+}
+
+// isCardSet returns true if cards are distinct Spanish cards, so that cardSetOf
+// represents them without loss.
+func isCardSet(cards []Card) bool {
+	return cardSetOf(cards).len() == len(cards)
+}
+
+func (s cardSet) len() int {
+	return bits.OnesCount64(uint64(s))
+}
+
+// appendCards appends the cards in the set to dst, in canonical order
+func (s cardSet) appendCards(dst []Card) []Card {
+	for ; s != 0; s &= s - 1 {
+		dst = append(dst, cardsByIndex[bits.TrailingZeros64(uint64(s))])
+	}
+	return dst
+}
+
+// move is a throw in compact form: the Index of the thrown card, and the table
+// cards it captures (none for a throw to the table).
+type move struct {
+	card     int
+	captured cardSet
+}
+
+// subsetFinder finds the subsets of the table cards that add up to a value,
+// without allocating. The table is kept in canonical order, along with the
+// sum of the values from each position to the end to prune the search.
+type subsetFinder struct {
+	indices   [deckSize]int
+	values    [deckSize]int
+	suffixSum [deckSize + 1]int
+	n         int
+}
+
+func newSubsetFinder(table cardSet) subsetFinder {
+	var f subsetFinder
+	for s := table; s != 0; s &= s - 1 {
+		index := bits.TrailingZeros64(uint64(s))
+		f.indices[f.n] = index
+		f.values[f.n] = cardValues[index]
+		f.n++
+	}
+	for i := f.n - 1; i >= 0; i-- {
+		f.suffixSum[i] = f.suffixSum[i+1] + f.values[i]
+	}
+	return f
+}
+
+// appendSubsets appends the subsets that add up to target to dst, in the same
+// order as findCombinationsDFS finds them.
+func (f *subsetFinder) appendSubsets(dst []cardSet, target int) []cardSet {
+	return f.search(dst, target, 0, 0, -1)
+}
+
+// hasSubset returns true if some subset adds up to target
+func (f *subsetFinder) hasSubset(target int) bool {
+	var buf [1]cardSet
+	return len(f.search(buf[:0], target, 0, 0, 1)) > 0
+}
+
+// search appends the subsets of the cards from start on that add up to target,
+// joined with current, stopping once dst has limit subsets (or never, if limit is -1).
+func (f *subsetFinder) search(dst []cardSet, target int, start int, current cardSet, limit int) []cardSet {
+	if target == 0 {
+		return append(dst, current)
+	}
+	if target < 0 || f.suffixSum[start] < target {
+		return dst
+	}
+	for i := start; i < f.n && len(dst) != limit; i++ {
+		dst = f.search(dst, target-f.values[i], i+1, current|1<<f.indices[i], limit)
+	}
+	return dst
+}
+
+// capturesFor appends to dst the table subsets that the card with the given
+// Index can capture under the game's rules.
+func (g *GameState) capturesFor(dst []cardSet, f *subsetFinder, index int) []cardSet {
+	value := cardValues[index]
+	if !g.isScopa() {
+		if value >= g.rules().CaptureSum {
+			return dst
+		}
+		return f.appendSubsets(dst, g.rules().CaptureSum-value)
+	}
+
+	// In Scopa, single matching cards are taken before any combination
+	start := len(dst)
+	for i := 0; i < f.n; i++ {
+		if f.values[i] == value {
+			dst = append(dst, 1<<f.indices[i])
+		}
+	}
+	if len(dst) > start {
+		return dst
+	}
+	return f.appendSubsets(dst, value)
+}
+
+// canCapture returns true if card can capture any table cards under the game's rules
+func (g *GameState) canCapture(card Card) bool {
+	index := card.Index()
+	if index == -1 || !isCardSet(g.TableCards) {
+		return len(g.findAllValidCombinations(card, g.TableCards)) > 0
+	}
+	f := newSubsetFinder(cardSetOf(g.TableCards))
+	value := cardValues[index]
+	if !g.isScopa() {
+		return value < g.rules().CaptureSum && f.hasSubset(g.rules().CaptureSum-value)
+	}
+	return f.hasSubset(value)
+}
+
+// appendMoves appends to dst the throws that the player whose turn it is may
+// play, in the same order as CalculatePossibleActions lists them. It doesn't
+// allocate when dst has enough capacity.
+//
+// The hand and the table must be sets of cards (see isCardSet); otherwise, use
+// findAllThrows.
+func (g *GameState) appendMoves(dst []move) []move {
+	return g.appendMovesFrom(dst, cardSetOf(g.Hands[g.TurnPlayerID].Cards), cardSetOf(g.TableCards))
+}
+
+// appendMovesFrom is appendMoves for the given hand and table, which must be
+// those of the player whose turn it is.
+func (g *GameState) appendMovesFrom(dst []move, hand cardSet, table cardSet) []move {
+	f := newSubsetFinder(table)
+
+	var buf [64]cardSet
+	start := len(dst)
+	for s := hand; s != 0; s &= s - 1 {
+		index := bits.TrailingZeros64(uint64(s))
+		for _, captured := range g.capturesFor(buf[:0], &f, index) {
+			dst = append(dst, move{card: index, captured: captured})
+		}
+	}
+
+	// If no card can capture (or capturing is optional), cards may be thrown to the table
+	if len(dst) == start || g.rules().OptionalCapture {
+		for s := hand; s != 0; s &= s - 1 {
+			dst = append(dst, move{card: bits.TrailingZeros64(uint64(s))})
+		}
+	}
+	return dst
+}
+
+// appendThrowCardJSON appends the JSON encoding of a throw to dst, exactly as
+// encoding/json would encode the ActionThrowCard, but much faster.
+func appendThrowCardJSON(dst []byte, card Card, captured []Card) []byte {
+	dst = append(dst, `{"name":"`+THROW_CARD+`","card":`...)
+	dst = appendCardJSON(dst, card)
+	dst = append(dst, `,"capturedTableCards":`...)
+	if captured == nil {
+		dst = append(dst, "null"...)
+	} else {
+		dst = append(dst, '[')
+		for i, c := range captured {
+			if i > 0 {
+				dst = append(dst, ',')
+			}
+			dst = appendCardJSON(dst, c)
+		}
+		dst = append(dst, ']')
+	}
+	return append(dst, '}')
+}
+
+const (
+	// maxCardJSONLen is the length of the longest card encoding: {"suit":"espada","number":12}
+	maxCardJSONLen = 29
+
+	// maxPlayerActJSONLen is a bound on the length of the encoding of a victory
+	// claim, or of an action that may be run out of turn.
+	maxPlayerActJSONLen = 48
+)
+
+// maxMoveJSONLen returns a bound on the length of the encoding of a move
+func maxMoveJSONLen(m move) int {
+	return len(`{"name":"`+THROW_CARD+`","card":,"capturedTableCards":[]}`) + (maxCardJSONLen+1)*(m.captured.len()+1)
+}
+
+// appendMoveJSON is like appendThrowCardJSON, for a move
+func appendMoveJSON(dst []byte, m move) []byte {
+	dst = append(dst, `{"name":"`+THROW_CARD+`","card":`...)
+	dst = append(dst, cardJSON[m.card]...)
+	dst = append(dst, `,"capturedTableCards":[`...)
+	for s := m.captured; s != 0; s &= s - 1 {
+		if s != m.captured {
+			dst = append(dst, ',')
+		}
+		dst = append(dst, cardJSON[bits.TrailingZeros64(uint64(s))]...)
+	}
+	return append(dst, "]}"...)
+}
+
+func appendCardJSON(dst []byte, card Card) []byte {
+	if i := card.Index(); i != -1 {
+		return append(dst, cardJSON[i]...)
+	}
+	bs, _ := json.Marshal(card)
+	return append(dst, bs...)
+}
+
+// appendPlayerActJSON appends the JSON encoding of an action that may be run out of turn
+func appendPlayerActJSON(dst []byte, name string, playerID int) []byte {
+	dst = append(dst, `{"name":"`...)
+	dst = append(dst, name...)
+	dst = append(dst, `","playerID":`...)
+	dst = strconv.AppendInt(dst, int64(playerID), 10)
+	return append(dst, '}')
+}
@@ -0,0 +1,65 @@
+package escoba
+
+// Clone returns a deep copy of the game: running actions on either of them
+// leaves the other untouched. The clone keeps the game's Shuffler and its
+// record of the initial deal (so it can undo actions), but not its observers.
+//
+// It's cheap enough to run on every node of a tree search: the slices that the
+// engine only ever appends to (e.g. Actions, piles and the deck) share their
+// backing arrays, capped so that appending to one copy never writes to the other.
+func (g GameState) Clone() *GameState {
+	clone := g
+	clone.observers = nil
+
+	if g.deck != nil {
+		clone.deck = &deck{cards: appendOnly(g.deck.cards)}
+	}
+	if g.Hands != nil {
+		clone.Hands = make(map[int]*Hand, len(g.Hands))
+		for id, hand := range g.Hands {
+			if hand == nil {
+				clone.Hands[id] = nil
+				continue
+			}
+			// Cards are removed from hands in place, so hands can't be shared
+			clone.Hands[id] = &Hand{Cards: append(make([]Card, 0, len(hand.Cards)), hand.Cards...), HiddenCount: hand.HiddenCount}
+		}
+	}
+	if g.Piles != nil {
+		clone.Piles = make(map[int][]Card, len(g.Piles))
+		for id, pile := range g.Piles {
+			clone.Piles[id] = appendOnly(pile)
+		}
+	}
+
+	// Cards are inserted into the table in place, so it can't be shared either
+	if g.TableCards != nil {
+		clone.TableCards = append(make([]Card, 0, len(g.TableCards)+1), g.TableCards...)
+	}
+	clone.Escobas = copyIntMap(g.Escobas)
+	clone.Scores = copyIntMap(g.Scores)
+	clone.Penalties = copyIntMap(g.Penalties)
+	clone.LastSetResults = g.LastSetResults.clone()
+	clone.PossibleActions = appendOnly(g.PossibleActions)
+	clone.Actions = appendOnly(g.Actions)
+	clone.ActionOwnerPlayerIDs = appendOnly(g.ActionOwnerPlayerIDs)
+	clone.TieBreakSideIDs = appendOnly(g.TieBreakSideIDs)
+	clone.DrawOfferSideIDs = appendOnly(g.DrawOfferSideIDs)
+	return &clone
+}
+
+// Apply returns the game after running the action, leaving g untouched. It's
+// RunAction without side effects, for search algorithms and analysis tools.
+func (g GameState) Apply(action Action) (GameState, error) {
+	next := g.Clone()
+	if err := next.RunAction(action); err != nil {
+		return GameState{}, err
+	}
+	return *next, nil
+}
+
+// appendOnly returns s with its capacity capped to its length, so that it can be
+// shared by games that only append to it: the first append reallocates it.
+func appendOnly[S ~[]E, E any](s S) S {
+	return s[:len(s):len(s)]
+}
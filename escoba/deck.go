@@ -1,8 +1,10 @@
 package escoba
 
 import (
+	"cmp"
 	"fmt"
 	"math/rand"
+	"slices"
 )
 
 const (
@@ -34,16 +36,83 @@ func (c Card) GetEscobaValue() int {
 	return c.Number - 2
 }
 
+// suits are the suits of a Spanish deck, in canonical order
+var suits = []string{ORO, COPA, ESPADA, BASTO}
+
+// Index returns the position of the card in SpanishCards(), from 0 to 39. It's
+// the card's canonical order: by suit (oro, copa, espada, basto) and then by
+// number. It returns -1 for a card that isn't in a Spanish deck.
+func (c Card) Index() int {
+	suitIndex := slices.Index(suits, c.Suit)
+	if suitIndex == -1 || c.Number < 1 || c.Number > 12 || c.Number == 8 || c.Number == 9 {
+		return -1
+	}
+	return suitIndex*10 + c.GetEscobaValue() - 1
+}
+
+// CompareCards compares two cards by their canonical order (see Card.Index),
+// returning a negative number if a comes first, zero if they are the same card
+// and a positive number if b comes first.
+func CompareCards(a, b Card) int {
+	if c := cmp.Compare(a.Index(), b.Index()); c != 0 {
+		return c
+	}
+	// Cards that aren't in a Spanish deck still get a stable order
+	return cmp.Or(cmp.Compare(a.Suit, b.Suit), cmp.Compare(a.Number, b.Number))
+}
+
+// SortCards sorts cards in canonical order (see Card.Index).
+//
+// The engine keeps hands and table cards in this order, and lists capture
+// combinations with their cards in this order too.
+func SortCards(cards []Card) {
+	slices.SortFunc(cards, CompareCards)
+}
+
+// sortedCards returns a copy of cards in canonical order
+func sortedCards(cards []Card) []Card {
+	sorted := append([]Card{}, cards...)
+	SortCards(sorted)
+	return sorted
+}
+
+// insertCard inserts card into cards, which are in canonical order, keeping the order
+func insertCard(cards []Card, card Card) []Card {
+	i, _ := slices.BinarySearchFunc(cards, card, CompareCards)
+	return slices.Insert(cards, i, card)
+}
+
+// primieraValues are the points of each card number for the primiera in Scopa
+var primieraValues = map[int]int{7: 21, 6: 18, 1: 16, 5: 15, 4: 14, 3: 13, 2: 12, 10: 10, 11: 10, 12: 10}
+
+// GetPrimieraValue returns the points of the card for the primiera in Scopa (7=21, 6=18, 1=16, 5=15, 4=14, 3=13, 2=12, face cards=10)
+func (c Card) GetPrimieraValue() int {
+	return primieraValues[c.Number]
+}
+
 type deck struct {
 	cards []Card
 }
 
 // Hand represents a player's hand.
 type Hand struct {
+	// Cards are the cards in the hand. Dealt hands are in canonical order (see Card.Index).
 	Cards []Card `json:"cards"`
+
+	// HiddenCount is the number of cards in the hand that the viewer can't see.
+	// It is only non-zero in hands redacted by GameState.ViewFor.
+	HiddenCount int `json:"hiddenCount,omitempty"`
+}
+
+// Len returns the number of cards in the hand, including hidden ones.
+func (h *Hand) Len() int {
+	return len(h.Cards) + h.HiddenCount
 }
 
 func (h *Hand) String() string {
+	if h.HiddenCount > 0 {
+		return fmt.Sprintf("%d hidden cards", h.HiddenCount)
+	}
 	if len(h.Cards) == 0 {
 		return "empty hand"
 	}
@@ -58,9 +127,10 @@ func (h *Hand) String() string {
 	return result
 }
 
-func makeSpanishCards() []Card {
+// SpanishCards returns the 40 cards of a Spanish deck, unshuffled: suits in the
+// order oro, copa, espada, basto and numbers from 1 to 12 (no 8s or 9s).
+func SpanishCards() []Card {
 	cards := []Card{}
-	suits := []string{ORO, COPA, ESPADA, BASTO}
 	for _, suit := range suits {
 		for i := 1; i <= 12; i++ {
 			if i == 8 || i == 9 {
@@ -69,25 +139,57 @@ func makeSpanishCards() []Card {
 			cards = append(cards, Card{Suit: suit, Number: i})
 		}
 	}
+	return cards
+}
+
+// Shuffler orders the cards of a fresh deck at the start of every set.
+//
+// setNumber starts from 1, so that deterministic shufflers can produce a
+// different (but reproducible) deal for each set of the game.
+type Shuffler interface {
+	Shuffle(cards []Card, setNumber int)
+}
 
-	rand.Shuffle(len(cards), func(i, j int) {
+// seededShuffler shuffles with a math/rand source derived from a seed and the
+// set number, so the same seed always produces the same sequence of deals.
+type seededShuffler struct {
+	seed int64
+}
+
+func (s seededShuffler) Shuffle(cards []Card, setNumber int) {
+	r := rand.New(rand.NewSource(s.seed ^ int64(setNumber)*0x5DEECE66D))
+	r.Shuffle(len(cards), func(i, j int) {
 		cards[i], cards[j] = cards[j], cards[i]
 	})
+}
+
+// cardOrderShuffler ignores the incoming order and lays out the deck in a fixed order.
+type cardOrderShuffler struct {
+	cards []Card
+}
+
+func (s cardOrderShuffler) Shuffle(cards []Card, setNumber int) {
+	copy(cards, s.cards)
+}
 
+func makeSpanishCards(shuffler Shuffler, setNumber int) []Card {
+	cards := SpanishCards()
+	shuffler.Shuffle(cards, setNumber)
 	return cards
 }
 
-func newDeck() *deck {
-	return &deck{cards: makeSpanishCards()}
+func newDeck(shuffler Shuffler, setNumber int) *deck {
+	return &deck{cards: makeSpanishCards(shuffler, setNumber)}
 }
 
-func (d *deck) dealHand() *Hand {
+func (d *deck) dealHand(size int) *Hand {
 	hand := &Hand{Cards: []Card{}}
-	for i := 0; i < 3; i++ {
+	for i := 0; i < size; i++ {
 		if len(d.cards) > 0 {
 			hand.Cards = append(hand.Cards, d.cards[0])
 			d.cards = d.cards[1:]
 		}
 	}
+	SortCards(hand.Cards)
 	return hand
 }
@@ -0,0 +1,65 @@
+package escoba
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+)
+
+// UnseenCards returns the cards that playerID hasn't seen, in canonical order:
+// those in the other players' hands and in the deck. It only uses what the
+// player knows (see ViewFor), so it works on their view of the game too.
+func (g GameState) UnseenCards(playerID int) []Card {
+	seen := cardSetOf(g.TableCards)
+	if hand := g.Hands[playerID]; hand != nil {
+		seen |= cardSetOf(hand.Cards)
+	}
+	for _, pile := range g.Piles {
+		seen |= cardSetOf(pile)
+	}
+	unseen := ^seen & (1<<deckSize - 1)
+	return unseen.appendCards(nil)
+}
+
+// Determinize returns a complete game that is consistent with everything that
+// playerID knows: their hand, the table, the piles, the card counts and the
+// history. The cards they haven't seen (see UnseenCards) are dealt at random
+// to the other players' hands and to the deck, and later sets are shuffled
+// from a random seed.
+//
+// Search algorithms for imperfect information (e.g. Monte Carlo bots) can run
+// on many such samples without peeking at the real hidden cards. It works on
+// the full game as well as on playerID's view, and returns an error if the
+// card counts don't add up. The sample has no observers, and can't undo actions.
+func (g GameState) Determinize(playerID int, r *rand.Rand) (*GameState, error) {
+	view := g.ViewFor(playerID)
+	unseen := view.UnseenCards(playerID)
+
+	hiddenCount := view.DeckCount
+	for _, otherID := range sortedKeys(view.Hands) {
+		if hand := view.Hands[otherID]; hand != nil && otherID != playerID {
+			hiddenCount += hand.HiddenCount
+		}
+	}
+	if hiddenCount != len(unseen) {
+		return nil, fmt.Errorf("player %d hasn't seen %d cards, but %d are hidden", playerID, len(unseen), hiddenCount)
+	}
+
+	r.Shuffle(len(unseen), func(i, j int) {
+		unseen[i], unseen[j] = unseen[j], unseen[i]
+	})
+	for _, otherID := range sortedKeys(view.Hands) {
+		hand := view.Hands[otherID]
+		if hand == nil || otherID == playerID {
+			continue
+		}
+		cards := slices.Clone(unseen[:hand.HiddenCount])
+		SortCards(cards)
+		view.Hands[otherID] = &Hand{Cards: cards}
+		unseen = unseen[hand.HiddenCount:]
+	}
+	view.deck = &deck{cards: unseen}
+	view.shuffler = seededShuffler{seed: r.Int63()}
+	view.PossibleActions = view.possibleActionsJSON(view.TurnPlayerID)
+	return &view, nil
+}
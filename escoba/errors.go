@@ -0,0 +1,110 @@
+package escoba
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrActionNotPossible is wrapped by every *ActionError, except those for
+	// actions run on an ended game, which wrap ErrGameIsEnded.
+	ErrActionNotPossible = errors.New("action not possible")
+
+	// ErrGameIsEnded is wrapped by the *ActionError of actions run on an ended game.
+	ErrGameIsEnded = errors.New("game is ended")
+)
+
+const (
+	// ACTION_ERROR_GAME_IS_ENDED means that the game (or match) is ended.
+	ACTION_ERROR_GAME_IS_ENDED = "game_is_ended"
+
+	// ACTION_ERROR_NOT_YOUR_TURN means that the action can only be run by the
+	// player whose turn it is.
+	ACTION_ERROR_NOT_YOUR_TURN = "not_your_turn"
+
+	// ACTION_ERROR_WRONG_PLAYER means that the action names another player.
+	ACTION_ERROR_WRONG_PLAYER = "wrong_player"
+
+	// ACTION_ERROR_CARD_NOT_IN_HAND means that the thrown card is not in the player's hand.
+	ACTION_ERROR_CARD_NOT_IN_HAND = "card_not_in_hand"
+
+	// ACTION_ERROR_CARD_NOT_ON_TABLE means that a captured card is not on the table.
+	ACTION_ERROR_CARD_NOT_ON_TABLE = "card_not_on_table"
+
+	// ACTION_ERROR_WRONG_SUM means that the captured cards don't add up to what
+	// the thrown card needs (see Rules.CaptureSum).
+	ACTION_ERROR_WRONG_SUM = "wrong_sum"
+
+	// ACTION_ERROR_CAPTURE_IS_MANDATORY means that a card was thrown to the table
+	// when it could capture (see Rules.OptionalCapture).
+	ACTION_ERROR_CAPTURE_IS_MANDATORY = "capture_is_mandatory"
+
+	// ACTION_ERROR_MATCHING_CARD_FIRST means that, in Scopa, a combination was
+	// captured while a single card of the same value was on the table.
+	ACTION_ERROR_MATCHING_CARD_FIRST = "matching_card_first"
+
+	// ACTION_ERROR_NOT_ALLOWED means that the action is not allowed right now,
+	// e.g. answering a draw that wasn't offered, or claiming the win when the
+	// rules don't allow it.
+	ACTION_ERROR_NOT_ALLOWED = "not_allowed"
+
+	// ACTION_ERROR_INVALID_ACTION means that the action couldn't be understood,
+	// e.g. an unknown action name.
+	ACTION_ERROR_INVALID_ACTION = "invalid_action"
+)
+
+// ActionError explains why an action can't be run. Reason is one of the
+// ACTION_ERROR_* constants, and Details describes the problem for humans.
+type ActionError struct {
+	Reason  string `json:"reason"`
+	Details string `json:"details"`
+}
+
+func (e *ActionError) Error() string {
+	if e.Details == "" {
+		return fmt.Sprintf("%v: %v", e.Unwrap(), e.Reason)
+	}
+	return fmt.Sprintf("%v: %v (%v)", e.Unwrap(), e.Reason, e.Details)
+}
+
+func (e *ActionError) Unwrap() error {
+	if e.Reason == ACTION_ERROR_GAME_IS_ENDED {
+		return ErrGameIsEnded
+	}
+	return ErrActionNotPossible
+}
+
+func newActionError(reason string, format string, args ...any) *ActionError {
+	return &ActionError{Reason: reason, Details: fmt.Sprintf(format, args...)}
+}
+
+// CheckAction returns nil if playerID may run the action now, or else an
+// *ActionError explaining why not, e.g. because it's not their turn.
+func (g GameState) CheckAction(playerID int, action Action) error {
+	if g.IsEnded {
+		return newActionError(ACTION_ERROR_GAME_IS_ENDED, "the game is ended")
+	}
+	if ownerID := g.actionOwnerID(action); ownerID != playerID {
+		if ownerID != g.TurnPlayerID {
+			return newActionError(ACTION_ERROR_WRONG_PLAYER, "the action is for player %d", ownerID)
+		}
+		return newActionError(ACTION_ERROR_NOT_YOUR_TURN, "it's player %d's turn", g.TurnPlayerID)
+	}
+	return g.checkAction(action)
+}
+
+// checkAction returns nil if the action is possible, or else an *ActionError
+// explaining why not. Actions can explain it with a Check method; otherwise,
+// the error just says that the action is not allowed.
+func (g GameState) checkAction(action Action) error {
+	if g.IsEnded {
+		return newActionError(ACTION_ERROR_GAME_IS_ENDED, "the game is ended")
+	}
+	if checker, ok := action.(interface{ Check(GameState) error }); ok {
+		return checker.Check(g)
+	}
+	if !action.IsPossible(g) {
+		return newActionError(ACTION_ERROR_NOT_ALLOWED, "%v is not allowed now", action.GetName())
+	}
+	return nil
+}
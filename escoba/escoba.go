@@ -2,8 +2,30 @@ package escoba
 
 import (
 	"encoding/json"
-	"errors"
 	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+)
+
+const (
+	// END_REASON_TARGET_SCORE means that a player reached Rules.TargetScore.
+	END_REASON_TARGET_SCORE = "target_score"
+
+	// END_REASON_EXTRA_SETS means that extra sets broke a tie for the highest score.
+	END_REASON_EXTRA_SETS = "extra_sets"
+
+	// END_REASON_SUDDEN_DEATH means that sudden death broke a tie for the highest score.
+	END_REASON_SUDDEN_DEATH = "sudden_death"
+
+	// END_REASON_VICTORY_CLAIM means that a player rightly claimed the win during a set.
+	END_REASON_VICTORY_CLAIM = "victory_claim"
+
+	// END_REASON_RESIGNATION means that a player conceded the game.
+	END_REASON_RESIGNATION = "resignation"
+
+	// END_REASON_DRAW_AGREED means that the players agreed to a draw.
+	END_REASON_DRAW_AGREED = "draw_agreed"
 )
 
 // GameState represents the state of an Escoba game.
@@ -18,9 +40,10 @@ type GameState struct {
 	TurnPlayerID int `json:"turnPlayerID"`
 
 	// Hands is a map of player IDs to their respective hands.
+	// Player IDs go from 0 to Rules.Players - 1, in turn order.
 	Hands map[int]*Hand `json:"hands"`
 
-	// TableCards are the cards currently on the table
+	// TableCards are the cards currently on the table, in canonical order (see Card.Index).
 	TableCards []Card `json:"tableCards"`
 
 	// Piles are the captured cards for each player
@@ -30,7 +53,8 @@ type GameState struct {
 	Escobas map[int]int `json:"escobas"`
 
 	// Scores is a map of player IDs to their respective scores.
-	// Scores go from 0 to 15.
+	// Scores go from 0 to Rules.TargetScore (or a bit higher in the last set).
+	// In team mode (see Rules.Teams), it's a map of team IDs instead (see ScoreOf).
 	Scores map[int]int `json:"scores"`
 
 	// PossibleActions is a list of possible actions that the current player can take.
@@ -46,9 +70,31 @@ type GameState struct {
 	IsEnded bool `json:"isEnded"`
 
 	// WinnerPlayerID is the player ID of the player who won the game.
-	// Set to -1 if the game ended in a draw.
+	// Set to -1 if the game ended in a draw, or if it's played in teams.
 	WinnerPlayerID int `json:"winnerPlayerID"`
 
+	// WinnerTeamID is the team ID of the team that won the game in team mode.
+	// Set to -1 if the game ended in a draw, or if it's not played in teams.
+	WinnerTeamID int `json:"winnerTeamID"`
+
+	// Penalties is the number of points taken from each player (or team, in team
+	// mode) for claiming the win falsely (see Rules.FalseClaimPenalty).
+	Penalties map[int]int `json:"penalties"`
+
+	// DrawOfferSideIDs are the players (or teams, in team mode) who agree to the
+	// draw on offer, starting with the one who offered it. It's empty if there's
+	// no draw on offer.
+	DrawOfferSideIDs []int `json:"drawOfferSideIDs"`
+
+	// EndReason is how the game ended, or empty if it hasn't ended yet. See the
+	// END_REASON_* constants.
+	EndReason string `json:"endReason"`
+
+	// TieBreakSideIDs are the players (or teams, in team mode) who tied for the
+	// highest score after reaching Rules.TargetScore, while the tie is broken by
+	// extra sets or sudden death (see Rules.TieRule). It's empty otherwise.
+	TieBreakSideIDs []int `json:"tieBreakSideIDs"`
+
 	// Actions is the list of actions that have been run in the game.
 	Actions []json.RawMessage `json:"actions"`
 
@@ -67,25 +113,83 @@ type GameState struct {
 	// SetJustStarted is true if a set has just started.
 	SetJustStarted bool `json:"setJustStarted"`
 
-	deck *deck `json:"-"`
+	// SetNumber is the number of the current set, starting from 1.
+	SetNumber int `json:"setNumber"`
+
+	// DeckCount is the number of cards left in the deck.
+	DeckCount int `json:"deckCount"`
+
+	// Seed is the seed used to shuffle the deck of every set. Two games created
+	// with the same seed (and no custom Shuffler) are dealt exactly the same cards.
+	Seed int64 `json:"seed"`
+
+	// Rules are the rules the game is played by.
+	Rules Rules `json:"rules"`
+
+	// TakebacksAllowed is true if the players may agree to undo actions (see
+	// GameState.Undo). It is enforced by the server, not by the engine.
+	TakebacksAllowed bool `json:"takebacksAllowed"`
+
+	deck     *deck    `json:"-"`
+	shuffler Shuffler `json:"-"`
+
+	// initial is the game as it was first dealt, used to undo actions.
+	initial *Snapshot `json:"-"`
+
+	// observers are notified of the game's events (see WithObserver).
+	observers []Observer `json:"-"`
 }
 
-// SetResult contains the scoring results for a completed set of rounds
+// SetResult contains the scoring results for a completed set of rounds.
+// In team mode, every map is keyed by team ID, pooling the partners' piles and escobas.
 type SetResult struct {
 	CardCounts     map[int]int  `json:"cardCounts"`     // Number of cards in each player's pile
 	OroCardCounts  map[int]int  `json:"oroCardCounts"`  // Number of oro cards in each player's pile
 	HasSieteDeOro  map[int]bool `json:"hasSieteDeOro"`  // Whether each player has the 7 of oro
 	SetentaScores  map[int]int  `json:"setentaScores"`  // La setenta scores for each player
+	PrimieraScores map[int]int  `json:"primieraScores"` // Primiera scores for each player (only in Scopa)
 	PointsAwarded  map[int]int  `json:"pointsAwarded"`  // Points awarded to each player
 	EscobasThisSet map[int]int  `json:"escobasThisSet"` // Escobas made in this set
+	ByTeam         bool         `json:"byTeam"`         // Whether the maps are keyed by team ID
+}
+
+// clone returns a deep copy of the set result, or nil if sr is nil.
+func (sr *SetResult) clone() *SetResult {
+	if sr == nil {
+		return nil
+	}
+	hasSieteDeOro := make(map[int]bool, len(sr.HasSieteDeOro))
+	for k, v := range sr.HasSieteDeOro {
+		hasSieteDeOro[k] = v
+	}
+	return &SetResult{
+		CardCounts:     copyIntMap(sr.CardCounts),
+		OroCardCounts:  copyIntMap(sr.OroCardCounts),
+		HasSieteDeOro:  hasSieteDeOro,
+		SetentaScores:  copyIntMap(sr.SetentaScores),
+		PrimieraScores: copyIntMap(sr.PrimieraScores),
+		PointsAwarded:  copyIntMap(sr.PointsAwarded),
+		EscobasThisSet: copyIntMap(sr.EscobasThisSet),
+		ByTeam:         sr.ByTeam,
+	}
 }
 
 func (sr *SetResult) String() string {
 	result := "Set Results:\n"
-	for playerID := 0; playerID <= 1; playerID++ {
-		result += fmt.Sprintf("  Player %d: %d cards (%d oro), escobas: %d, setenta: %d, points awarded: %d",
-			playerID, sr.CardCounts[playerID], sr.OroCardCounts[playerID],
-			sr.EscobasThisSet[playerID], sr.SetentaScores[playerID], sr.PointsAwarded[playerID])
+	side := "Player"
+	if sr.ByTeam {
+		side = "Team"
+	}
+	for _, playerID := range sortedKeys(sr.PointsAwarded) {
+		if sr.PrimieraScores != nil {
+			result += fmt.Sprintf("  %s %d: %d cards (%d oro), escobas: %d, primiera: %d, points awarded: %d",
+				side, playerID, sr.CardCounts[playerID], sr.OroCardCounts[playerID],
+				sr.EscobasThisSet[playerID], sr.PrimieraScores[playerID], sr.PointsAwarded[playerID])
+		} else {
+			result += fmt.Sprintf("  %s %d: %d cards (%d oro), escobas: %d, setenta: %d, points awarded: %d",
+				side, playerID, sr.CardCounts[playerID], sr.OroCardCounts[playerID],
+				sr.EscobasThisSet[playerID], sr.SetentaScores[playerID], sr.PointsAwarded[playerID])
+		}
 		if sr.HasSieteDeOro[playerID] {
 			result += " [has 7 de oro]"
 		}
@@ -94,39 +198,125 @@ func (sr *SetResult) String() string {
 	return result
 }
 
+// New creates a new game and deals the first round of the first set.
+//
+// By default the deck is shuffled with a random seed, which is recorded in
+// GameState.Seed. Use WithSeed, WithCardOrder or WithShuffler to control the deals.
 func New(opts ...func(*GameState)) *GameState {
 	gs := &GameState{
 		RoundTurnPlayerID:    0, // Player 0 starts as mano
 		RoundNumber:          0,
 		LastCapturerPlayerID: 0, // Initialize to player 0 (mano) as default
-		Scores:               map[int]int{0: 0, 1: 0},
-		Hands:                map[int]*Hand{0: nil, 1: nil},
+		Scores:               map[int]int{},
+		Hands:                map[int]*Hand{},
 		TableCards:           []Card{},
-		Piles:                map[int][]Card{0: {}, 1: {}},
-		Escobas:              map[int]int{0: 0, 1: 0},
+		Piles:                map[int][]Card{},
+		Escobas:              map[int]int{},
+		Penalties:            map[int]int{},
 		IsEnded:              false,
 		WinnerPlayerID:       -1,
+		WinnerTeamID:         -1,
+		TieBreakSideIDs:      []int{},
+		DrawOfferSideIDs:     []int{},
 		Actions:              []json.RawMessage{},
-		deck:                 newDeck(),
+		Seed:                 rand.Int63(),
+		Rules:                DefaultRules(),
 	}
 
 	for _, opt := range opts {
 		opt(gs)
 	}
 
+	for _, playerID := range gs.PlayerIDs() {
+		gs.Hands[playerID] = nil
+	}
+	for _, sideID := range gs.sideIDs() {
+		gs.Scores[sideID] = 0
+		gs.Penalties[sideID] = 0
+	}
 	gs.startNewSet()
+
+	initial := gs.Snapshot()
+	gs.initial = &initial
 	return gs
 }
 
+// WithSeed makes the game shuffle every set's deck deterministically from seed.
+func WithSeed(seed int64) func(*GameState) {
+	return func(g *GameState) {
+		g.Seed = seed
+	}
+}
+
+// WithShuffler makes the game use shuffler to order every set's deck, instead of
+// shuffling from GameState.Seed.
+func WithShuffler(shuffler Shuffler) func(*GameState) {
+	return func(g *GameState) {
+		g.shuffler = shuffler
+	}
+}
+
+// WithCardOrder makes every set's deck be dealt in exactly the given order. The
+// first cards go to the players' hands and then to the table, where they are
+// sorted in canonical order (see SortCards).
+//
+// It panics if cards is not a permutation of SpanishCards().
+func WithCardOrder(cards []Card) func(*GameState) {
+	if !isSpanishDeck(cards) {
+		panic("escoba: card order must contain each of the 40 Spanish cards exactly once")
+	}
+	order := make([]Card, len(cards))
+	copy(order, cards)
+	return WithShuffler(cardOrderShuffler{cards: order})
+}
+
+// WithTakebacks allows the players to agree to undo actions.
+func WithTakebacks() func(*GameState) {
+	return func(g *GameState) {
+		g.TakebacksAllowed = true
+	}
+}
+
+func isSpanishDeck(cards []Card) bool {
+	expected := SpanishCards()
+	if len(cards) != len(expected) {
+		return false
+	}
+	seen := make(map[Card]bool, len(cards))
+	for _, card := range cards {
+		seen[card] = true
+	}
+	for _, card := range expected {
+		if !seen[card] {
+			return false
+		}
+	}
+	return true
+}
+
+// getShuffler returns the configured Shuffler, defaulting to one seeded from Seed.
+func (g *GameState) getShuffler() Shuffler {
+	if g.shuffler != nil {
+		return g.shuffler
+	}
+	return seededShuffler{seed: g.Seed}
+}
+
 func (g *GameState) startNewSet() {
-	g.deck = newDeck() // Fresh deck for each set
+	g.SetNumber++
+	g.deck = newDeck(g.getShuffler(), g.SetNumber) // Fresh deck for each set
 	g.TableCards = []Card{}
-	g.Piles = map[int][]Card{0: {}, 1: {}}
-	g.Escobas = map[int]int{0: 0, 1: 0}
+	g.Piles = map[int][]Card{}
+	g.Escobas = map[int]int{}
+	for _, playerID := range g.PlayerIDs() {
+		g.Piles[playerID] = []Card{}
+		g.Escobas[playerID] = 0
+	}
 	g.LastCapturerPlayerID = g.RoundTurnPlayerID // Reset to current mano
 	g.RoundNumber = 0
 	g.SetFinished = false
 	g.SetJustStarted = true
+	g.emit(EVENT_SET_STARTED, -1, nil)
 	g.startNewRound()
 }
 
@@ -135,48 +325,75 @@ func (g *GameState) startNewRound() {
 	g.RoundNumber++
 	g.TurnPlayerID = g.RoundTurnPlayerID
 
-	// Deal 3 cards to each player
-	if len(g.deck.cards) >= 6 {
-		g.Hands[0] = g.deck.dealHand()
-		g.Hands[1] = g.deck.dealHand()
+	// Deal Rules.HandSize cards to each player
+	if len(g.deck.cards) >= g.rules().Players*g.rules().HandSize {
+		for _, playerID := range g.PlayerIDs() {
+			g.Hands[playerID] = g.deck.dealHand(g.rules().HandSize)
+			g.emit(EVENT_HAND_DEALT, playerID, func(e *Event) { e.Cards = append([]Card{}, g.Hands[playerID].Cards...) })
+		}
 	} else {
 		// No more cards, set is finished
 		g.SetFinished = true
+		g.DeckCount = 0
 		g.scoreSet()
 		return
 	}
 
-	// On first round, deal 4 cards to table
+	// On first round, deal Rules.InitialTableSize cards to table
 	if g.RoundNumber == 1 {
-		for i := 0; i < 4; i++ {
+		for i := 0; i < g.rules().InitialTableSize; i++ {
 			if len(g.deck.cards) > 0 {
 				g.TableCards = append(g.TableCards, g.deck.cards[0])
 				g.deck.cards = g.deck.cards[1:]
 			}
 		}
-
-		// Check if table cards sum to 15 (dealer gets an escoba)
-		if g.sumCards(g.TableCards) == 15 {
-			g.Piles[g.RoundTurnPlayerID] = append(g.Piles[g.RoundTurnPlayerID], g.TableCards...)
-			g.Escobas[g.RoundTurnPlayerID]++
-			g.LastCapturerPlayerID = g.RoundTurnPlayerID // Track dealer as last capturer
-			g.TableCards = []Card{}
+		SortCards(g.TableCards)
+		g.emit(EVENT_TABLE_DEALT, -1, func(e *Event) { e.Cards = append([]Card{}, g.TableCards...) })
+
+		// Check if table cards sum to Rules.CaptureSum (or twice that), which is an escoba on the deal
+		if escobas := g.initialEscobas(); escobas > 0 {
+			playerID := g.RoundTurnPlayerID // The mano
+			if g.rules().InitialEscoba == INITIAL_ESCOBA_DEALER {
+				// The dealer sits before the mano
+				playerID = (g.RoundTurnPlayerID + g.rules().Players - 1) % g.rules().Players
+			}
+			action := newActionInitialEscoba(playerID, g.TableCards, escobas)
+			g.emit(EVENT_INITIAL_ESCOBA, playerID, func(e *Event) { e.Cards = append([]Card{}, g.TableCards...) })
+			escobas := g.Escobas[playerID]
+			_ = action.Run(g)
+			g.recordAction(action, playerID)
+			g.checkSuddenDeath(playerID, escobas)
 		}
 	}
 
+	g.DeckCount = len(g.deck.cards)
 	g.RoundFinished = false
-	g.PossibleActions = _serializeActions(g.CalculatePossibleActions())
+	if g.IsEnded {
+		g.PossibleActions = []json.RawMessage{}
+		return
+	}
+	g.PossibleActions = g.possibleActionsJSON(g.TurnPlayerID)
 }
 
-func (g *GameState) RunAction(action Action) error {
-	if g.IsEnded {
-		return errGameIsEnded
+// checkSuddenDeath ends the game if playerID, who had the given number of
+// escobas, just made one while their side is tied in sudden death: the first
+// escoba of a tied side wins, even on the deal.
+func (g *GameState) checkSuddenDeath(playerID int, escobas int) {
+	if g.Escobas[playerID] > escobas && slices.Contains(g.TieBreakSideIDs, g.sideOf(playerID)) && g.rules().TieRule == TIE_RULE_SUDDEN_DEATH {
+		g.Scores[g.sideOf(playerID)]++
+		g.endGame(g.sideOf(playerID), END_REASON_SUDDEN_DEATH)
 	}
+}
 
-	if !action.IsPossible(*g) {
-		return errActionNotPossible
+func (g *GameState) RunAction(action Action) error {
+	if err := g.checkAction(action); err != nil {
+		return err
 	}
 
+	playerID := g.TurnPlayerID
+	escobas := g.Escobas[playerID]
+
+	g.emit(EVENT_ACTION, g.actionOwnerID(action), func(e *Event) { e.Action = SerializeAction(action) })
 	err := action.Run(g)
 	if err != nil {
 		return err
@@ -184,13 +401,27 @@ func (g *GameState) RunAction(action Action) error {
 
 	g.RoundJustStarted = false
 	g.SetJustStarted = false
-	bs := SerializeAction(action)
-	g.Actions = append(g.Actions, bs)
-	g.ActionOwnerPlayerIDs = append(g.ActionOwnerPlayerIDs, g.CurrentPlayerID())
+	g.recordAction(action, g.actionOwnerID(action))
 
-	// Check if round is finished (both players have no cards)
-	if len(g.Hands[0].Cards) == 0 && len(g.Hands[1].Cards) == 0 {
-		g.RoundFinished = true
+	// Playing on withdraws another side's draw offer
+	if action.GetName() == THROW_CARD && len(g.DrawOfferSideIDs) > 0 && !slices.Contains(g.DrawOfferSideIDs, g.sideOf(playerID)) {
+		g.DrawOfferSideIDs = []int{}
+	}
+
+	g.checkSuddenDeath(playerID, escobas)
+
+	// The game can end during a set (e.g. claiming the win), with cards still in hand
+	if g.IsEnded {
+		g.PossibleActions = []json.RawMessage{}
+		return nil
+	}
+
+	// Check if round is finished (no player has cards)
+	g.RoundFinished = true
+	for _, playerID := range g.PlayerIDs() {
+		if len(g.Hands[playerID].Cards) > 0 {
+			g.RoundFinished = false
+		}
 	}
 
 	// Start new round if current round is finished
@@ -204,115 +435,267 @@ func (g *GameState) RunAction(action Action) error {
 		return nil
 	}
 
-	// Switch player turn
+	// Pass the turn to the next player
 	if !g.IsEnded && !g.RoundFinished && action.YieldsTurn(*g) {
-		g.TurnPlayerID = g.OpponentOf(g.TurnPlayerID)
+		g.TurnPlayerID = g.NextPlayerID(g.TurnPlayerID)
 	}
 
-	g.PossibleActions = _serializeActions(g.CalculatePossibleActions())
+	g.PossibleActions = g.possibleActionsJSON(g.TurnPlayerID)
 	return nil
 }
 
+// recordAction appends the action to the game's history, as run by ownerPlayerID
+func (g *GameState) recordAction(action Action, ownerPlayerID int) {
+	g.Actions = append(g.Actions, SerializeAction(action))
+	g.ActionOwnerPlayerIDs = append(g.ActionOwnerPlayerIDs, ownerPlayerID)
+}
+
+// initialEscobas returns the number of escobas awarded for the initial table cards
+func (g *GameState) initialEscobas() int {
+	if g.isScopa() || g.rules().InitialEscoba == INITIAL_ESCOBA_NONE || len(g.TableCards) == 0 {
+		return 0
+	}
+
+	captureSum := g.rules().CaptureSum
+	switch g.sumCards(g.TableCards) {
+	case captureSum:
+		return 1
+	case 2 * captureSum:
+		// Two escobas, if the cards can be split into two groups that sum to captureSum
+		if !g.rules().InitialEscobaThirty {
+			return 0
+		}
+		var combinations [][]Card
+		findCombinationsDFS(g.TableCards, captureSum, []Card{}, 0, &combinations)
+		if len(combinations) > 0 {
+			return 2
+		}
+	}
+	return 0
+}
+
 func (g *GameState) scoreSet() {
+	// Remaining table cards go to the last player who captured
+	if len(g.TableCards) > 0 {
+		g.emit(EVENT_LAST_CAPTURER_SWEEP, g.LastCapturerPlayerID, func(e *Event) { e.Cards = append([]Card{}, g.TableCards...) })
+		g.Piles[g.LastCapturerPlayerID] = append(g.Piles[g.LastCapturerPlayerID], g.TableCards...)
+		g.TableCards = []Card{}
+	}
+
+	// Each side (a player, or a team in team mode) scores with its pooled piles and escobas
+	sidePiles := make(map[int][]Card)
+	sideEscobas := make(map[int]int)
+	for _, playerID := range g.PlayerIDs() {
+		sideID := g.sideOf(playerID)
+		sidePiles[sideID] = append(sidePiles[sideID], g.Piles[playerID]...)
+		sideEscobas[sideID] += g.Escobas[playerID]
+	}
+
 	result := &SetResult{
 		CardCounts:     make(map[int]int),
 		OroCardCounts:  make(map[int]int),
 		HasSieteDeOro:  make(map[int]bool),
 		SetentaScores:  make(map[int]int),
 		PointsAwarded:  make(map[int]int),
-		EscobasThisSet: map[int]int{0: g.Escobas[0], 1: g.Escobas[1]},
+		EscobasThisSet: sideEscobas,
+		ByTeam:         g.rules().Teams,
 	}
-
-	// Remaining table cards go to the last player who captured
-	if len(g.TableCards) > 0 {
-		g.Piles[g.LastCapturerPlayerID] = append(g.Piles[g.LastCapturerPlayerID], g.TableCards...)
-		g.TableCards = []Card{}
+	if g.isScopa() {
+		result.PrimieraScores = make(map[int]int)
 	}
 
-	// Count total cards and oro cards for each player
-	for playerID := 0; playerID <= 1; playerID++ {
-		result.CardCounts[playerID] = len(g.Piles[playerID])
-		result.OroCardCounts[playerID] = 0
-		result.HasSieteDeOro[playerID] = false
+	// Count total cards and oro cards for each side
+	for _, sideID := range g.sideIDs() {
+		result.CardCounts[sideID] = len(sidePiles[sideID])
+		result.OroCardCounts[sideID] = 0
+		result.HasSieteDeOro[sideID] = false
 
-		for _, card := range g.Piles[playerID] {
+		for _, card := range sidePiles[sideID] {
 			if card.Suit == ORO {
-				result.OroCardCounts[playerID]++
+				result.OroCardCounts[sideID]++
 				if card.Number == 7 {
-					result.HasSieteDeOro[playerID] = true
+					result.HasSieteDeOro[sideID] = true
 				}
 			}
 		}
 
-		// Calculate la setenta
-		result.SetentaScores[playerID] = g.calculateSetenta(playerID)
+		// Calculate la setenta (or the primiera, in Scopa)
+		if g.isScopa() {
+			result.PrimieraScores[sideID] = primieraScore(sidePiles[sideID])
+		} else {
+			result.SetentaScores[sideID] = setentaScore(sidePiles[sideID])
+		}
 	}
 
-	// Award points
+	// Award points. In the "most" categories, a tie between the leading sides awards no point.
 	// 1. Escobas
-	for playerID := 0; playerID <= 1; playerID++ {
-		result.PointsAwarded[playerID] += g.Escobas[playerID]
+	for _, sideID := range g.sideIDs() {
+		result.PointsAwarded[sideID] += sideEscobas[sideID]
 	}
 
 	// 2. Most cards
-	if result.CardCounts[0] > result.CardCounts[1] {
-		result.PointsAwarded[0]++
-	} else if result.CardCounts[1] > result.CardCounts[0] {
-		result.PointsAwarded[1]++
+	if sideID := uniqueMaxID(result.CardCounts); sideID != -1 {
+		result.PointsAwarded[sideID]++
 	}
 
 	// 3. Most oro cards
-	if result.OroCardCounts[0] > result.OroCardCounts[1] {
-		result.PointsAwarded[0]++
-	} else if result.OroCardCounts[1] > result.OroCardCounts[0] {
-		result.PointsAwarded[1]++
+	if sideID := uniqueMaxID(result.OroCardCounts); sideID != -1 {
+		result.PointsAwarded[sideID]++
 	}
 
 	// 4. Seven of oro
-	if result.HasSieteDeOro[0] {
-		result.PointsAwarded[0]++
-	} else if result.HasSieteDeOro[1] {
-		result.PointsAwarded[1]++
+	for _, sideID := range g.sideIDs() {
+		if result.HasSieteDeOro[sideID] {
+			result.PointsAwarded[sideID]++
+		}
 	}
 
-	// 5. La setenta
-	if result.SetentaScores[0] > result.SetentaScores[1] && result.SetentaScores[0] > 0 {
-		result.PointsAwarded[0]++
-	} else if result.SetentaScores[1] > result.SetentaScores[0] && result.SetentaScores[1] > 0 {
-		result.PointsAwarded[1]++
+	// 5. La setenta (or the primiera, in Scopa)
+	setentaScores := result.SetentaScores
+	if g.isScopa() {
+		setentaScores = result.PrimieraScores
+	}
+	if sideID := uniqueMaxID(setentaScores); sideID != -1 && setentaScores[sideID] > 0 {
+		result.PointsAwarded[sideID]++
 	}
 
 	// Apply points to scores
-	for playerID := 0; playerID <= 1; playerID++ {
-		g.Scores[playerID] += result.PointsAwarded[playerID]
+	for _, sideID := range g.sideIDs() {
+		g.Scores[sideID] += result.PointsAwarded[sideID]
 	}
 
 	g.LastSetResults = result
+	g.emit(EVENT_SET_SCORED, -1, func(e *Event) { e.SetResult = result.clone() })
 
 	// Check for game end
-	if g.Scores[0] >= 15 || g.Scores[1] >= 15 {
-		g.IsEnded = true
-		if g.Scores[0] > g.Scores[1] {
-			g.WinnerPlayerID = 0
-		} else if g.Scores[1] > g.Scores[0] {
-			g.WinnerPlayerID = 1
-		} else {
-			// Draw: both players have equal points >= 15
-			g.WinnerPlayerID = -1
-		}
+	if len(g.TieBreakSideIDs) > 0 {
+		g.breakTie(result)
 	} else {
+		g.checkTargetScore()
+	}
+
+	if !g.IsEnded {
 		// Start new set
-		g.RoundTurnPlayerID = g.OpponentOf(g.RoundTurnPlayerID) // Switch mano
+		g.RoundTurnPlayerID = g.NextPlayerID(g.RoundTurnPlayerID) // Pass mano
 		g.startNewSet()
 	}
 }
 
-func (g *GameState) calculateSetenta(playerID int) int {
+// checkTargetScore ends the game if any side reached Rules.TargetScore, or starts
+// a tie-break if the tied leaders must keep playing (see Rules.TieRule).
+func (g *GameState) checkTargetScore() {
+	reachedTarget := 0
+	for _, sideID := range g.sideIDs() {
+		if g.Scores[sideID] >= g.rules().TargetScore {
+			reachedTarget++
+		}
+	}
+	if reachedTarget == 0 {
+		return
+	}
+	if reachedTarget > 1 && g.rules().TieRule == TIE_RULE_DRAW {
+		g.endGame(-1, END_REASON_TARGET_SCORE)
+		return
+	}
+
+	// The highest score wins; if several sides tie for it, the tie rule decides
+	leaders := maxIDs(g.Scores)
+	switch {
+	case len(leaders) == 1:
+		g.endGame(leaders[0], END_REASON_TARGET_SCORE)
+	case g.rules().TieRule == TIE_RULE_EXTRA_SETS || g.rules().TieRule == TIE_RULE_SUDDEN_DEATH:
+		g.TieBreakSideIDs = leaders
+	default:
+		g.endGame(-1, END_REASON_TARGET_SCORE)
+	}
+}
+
+// breakTie ends the game if the set that just finished broke the tie for the
+// highest score. Otherwise, the tie-break goes on with another set.
+func (g *GameState) breakTie(result *SetResult) {
+	switch g.rules().TieRule {
+	case TIE_RULE_EXTRA_SETS:
+		if leaders := maxIDs(g.Scores); len(leaders) == 1 {
+			g.endGame(leaders[0], END_REASON_EXTRA_SETS)
+		}
+	case TIE_RULE_SUDDEN_DEATH:
+		// No escoba was made, so the tied side with the most points in the set wins
+		points := map[int]int{}
+		for _, sideID := range g.TieBreakSideIDs {
+			points[sideID] = result.PointsAwarded[sideID]
+		}
+		if winnerID := uniqueMaxID(points); winnerID != -1 {
+			g.endGame(winnerID, END_REASON_SUDDEN_DEATH)
+		}
+	}
+}
+
+// endGame ends the game, won by the given side, or drawn if sideID is -1.
+func (g *GameState) endGame(sideID int, reason string) {
+	g.IsEnded = true
+	g.EndReason = reason
+	g.TieBreakSideIDs = []int{}
+	if g.rules().Teams {
+		g.WinnerTeamID = sideID
+	} else {
+		g.WinnerPlayerID = sideID
+	}
+	g.emit(EVENT_GAME_ENDED, -1, func(e *Event) {
+		e.WinnerID = sideID
+		e.EndReason = reason
+	})
+}
+
+// maxIDs returns the (player or team) IDs with the highest value, in ascending order
+func maxIDs(values map[int]int) []int {
+	var ids []int
+	for _, id := range sortedKeys(values) {
+		switch {
+		case len(ids) == 0 || values[id] > values[ids[0]]:
+			ids = []int{id}
+		case values[id] == values[ids[0]]:
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// uniqueMaxID returns the (player or team) ID with the highest value, or -1 if several tie for it
+func uniqueMaxID(values map[int]int) int {
+	maxPlayerID := -1
+	maxValue := 0
+	tied := false
+	for _, playerID := range sortedKeys(values) {
+		value := values[playerID]
+		switch {
+		case maxPlayerID == -1 || value > maxValue:
+			maxPlayerID, maxValue, tied = playerID, value, false
+		case value == maxValue:
+			tied = true
+		}
+	}
+	if tied {
+		return -1
+	}
+	return maxPlayerID
+}
+
+// sortedKeys returns the keys of a map keyed by player or team ID, in ascending order
+func sortedKeys[V any](m map[int]V) []int {
+	keys := make([]int, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+func setentaScore(cards []Card) int {
 	// For each suit, find the highest card <= 7
 	suitBest := make(map[string]int)
 	suitHasCard := make(map[string]bool)
 
-	for _, card := range g.Piles[playerID] {
+	for _, card := range cards {
 		value := card.GetEscobaValue()
 		if value <= 7 {
 			if !suitHasCard[card.Suit] || value > suitBest[card.Suit] {
@@ -334,6 +717,27 @@ func (g *GameState) calculateSetenta(playerID int) int {
 	return total
 }
 
+func primieraScore(cards []Card) int {
+	// For each suit, find the card with the most primiera points
+	suitBest := make(map[string]int)
+	for _, card := range cards {
+		if value := card.GetPrimieraValue(); value > suitBest[card.Suit] {
+			suitBest[card.Suit] = value
+		}
+	}
+
+	// Must have at least one card of each suit
+	if len(suitBest) < 4 {
+		return 0
+	}
+
+	total := 0
+	for _, value := range suitBest {
+		total += value
+	}
+	return total
+}
+
 func (g *GameState) sumCards(cards []Card) int {
 	sum := 0
 	for _, card := range cards {
@@ -346,49 +750,297 @@ func (g GameState) CurrentPlayerID() int {
 	return g.TurnPlayerID
 }
 
+// PlayerIDs returns the IDs of the players seated at the table, in turn order.
+func (g GameState) PlayerIDs() []int {
+	playerIDs := make([]int, g.rules().Players)
+	for i := range playerIDs {
+		playerIDs[i] = i
+	}
+	return playerIDs
+}
+
+// NextPlayerID returns the player who plays after playerID, going around the table.
+func (g GameState) NextPlayerID(playerID int) int {
+	return (playerID + 1) % g.rules().Players
+}
+
+// TeamOf returns the team of playerID in team mode (see Rules.Teams). Partners
+// sit across the table, so team 0 is players 0 and 2, and team 1 is players 1 and 3.
+func (g GameState) TeamOf(playerID int) int {
+	return playerID % 2
+}
+
+// PartnerOf returns the partner of playerID in team mode (see Rules.Teams).
+func (g GameState) PartnerOf(playerID int) int {
+	return (playerID + 2) % 4
+}
+
+// ScoreOf returns the score of playerID, which in team mode is their team's score.
+func (g GameState) ScoreOf(playerID int) int {
+	return g.Scores[g.sideOf(playerID)]
+}
+
+// IsWinner returns true if playerID won the game, alone or with their team.
+func (g GameState) IsWinner(playerID int) bool {
+	if !g.IsEnded {
+		return false
+	}
+	if g.rules().Teams {
+		return g.WinnerTeamID != -1 && g.WinnerTeamID == g.TeamOf(playerID)
+	}
+	return g.WinnerPlayerID != -1 && g.WinnerPlayerID == playerID
+}
+
+// sideIDs returns the IDs of the sides that score: the players or, in team mode, the teams.
+func (g GameState) sideIDs() []int {
+	if g.rules().Teams {
+		return []int{0, 1}
+	}
+	return g.PlayerIDs()
+}
+
+// sideOf returns the side that playerID scores for: themselves or, in team mode, their team.
+func (g GameState) sideOf(playerID int) int {
+	if g.rules().Teams {
+		return g.TeamOf(playerID)
+	}
+	return playerID
+}
+
+// OpponentOf returns the other player in a two-player game. With more players,
+// it returns the next player (see NextPlayerID).
 func (g GameState) OpponentOf(playerID int) int {
-	if playerID == 0 {
-		return 1
+	return g.NextPlayerID(playerID)
+}
+
+// ProvisionalScore returns the score of playerID (or of their team, in team mode)
+// counting the points of the current set that can't be lost anymore: escobas, the
+// 7 of oro, and the most cards or oro cards once no other side can catch up.
+func (g GameState) ProvisionalScore(playerID int) int {
+	sideID := g.sideOf(playerID)
+	score := g.Scores[sideID]
+
+	cards, oros := map[int]int{}, map[int]int{}
+	capturedCards, capturedOros := 0, 0
+	for _, id := range g.PlayerIDs() {
+		side := g.sideOf(id)
+		if side == sideID {
+			score += g.Escobas[id]
+		}
+		for _, card := range g.Piles[id] {
+			cards[side]++
+			capturedCards++
+			if card.Suit != ORO {
+				continue
+			}
+			oros[side]++
+			capturedOros++
+			if card.Number == 7 && side == sideID {
+				score++
+			}
+		}
 	}
-	return 0
+
+	if g.isSecuredMajority(sideID, cards, deckSize-capturedCards) {
+		score++
+	}
+	if g.isSecuredMajority(sideID, oros, deckSize/4-capturedOros) {
+		score++
+	}
+	return score
+}
+
+// isSecuredMajority returns true if sideID has more cards than any other side
+// could get by capturing all of the uncaptured ones.
+func (g GameState) isSecuredMajority(sideID int, counts map[int]int, uncaptured int) bool {
+	for _, otherID := range g.sideIDs() {
+		if otherID != sideID && counts[sideID] <= counts[otherID]+uncaptured {
+			return false
+		}
+	}
+	return true
 }
 
 // IsDraw returns true if the game ended in a draw
 func (g GameState) IsDraw() bool {
+	if g.rules().Teams {
+		return g.IsEnded && g.WinnerTeamID == -1
+	}
 	return g.IsEnded && g.WinnerPlayerID == -1
 }
 
+// CalculatePossibleActionsFor returns the actions that playerID may run now: the
+// turn's actions (see CalculatePossibleActions) if it's their turn, and the ones
+// that may be run out of turn: resigning, and offering, accepting or declining a draw.
+func (g GameState) CalculatePossibleActionsFor(playerID int) []Action {
+	if g.IsEnded {
+		return nil
+	}
+	var buf [64]move
+	return g.possibleActionsFor(playerID, buf[:0]).actions(playerID)
+}
+
+// CalculatePossibleActions returns the actions that the player whose turn it is
+// may run to play their turn.
 func (g GameState) CalculatePossibleActions() []Action {
-	var actions []Action
-	hasValidCombinations := false
-
-	// For each card in player's hand, find all valid combinations
-	for _, card := range g.Hands[g.TurnPlayerID].Cards {
-		validCombinations := g.findAllValidCombinations(card, g.TableCards)
-
-		if len(validCombinations) > 0 {
-			hasValidCombinations = true
-			// Create an action for each valid combination
-			for _, combination := range validCombinations {
-				actions = append(actions, newActionThrowCard(card, combination))
-			}
+	var buf [64]move
+	return g.possibleTurnActions(buf[:0]).actions(g.TurnPlayerID)
+}
+
+// playerActNames are the actions that may be run out of turn, in the order they're listed
+var playerActNames = [...]string{RESIGN, OFFER_DRAW, ACCEPT_DRAW, DECLINE_DRAW}
+
+// possibleActions is what a player may run now, in the order it's listed: the
+// throws of the turn, a victory claim, and the actions that may be run out of
+// turn. Both CalculatePossibleActionsFor and the serialized PossibleActions are
+// built from it, so that they always agree.
+type possibleActions struct {
+	// moves are the throws of the turn, unless the hand or the table aren't sets
+	// of cards (see isCardSet), in which case the throws are in throws instead.
+	moves  []move
+	throws []Action
+
+	claim      bool
+	playerActs [len(playerActNames)]bool
+}
+
+// possibleActionsFor works out what playerID may run now, appending the moves to movesBuf
+func (g *GameState) possibleActionsFor(playerID int, movesBuf []move) possibleActions {
+	var p possibleActions
+	if g.IsEnded {
+		return p
+	}
+	if playerID == g.TurnPlayerID {
+		p = g.possibleTurnActions(movesBuf)
+	}
+	for i, name := range playerActNames {
+		p.playerActs[i] = g.isPlayerActPossible(name, playerID)
+	}
+	return p
+}
+
+// possibleTurnActions works out what the player whose turn it is may run to play
+// their turn, appending the moves to movesBuf.
+func (g *GameState) possibleTurnActions(movesBuf []move) possibleActions {
+	var p possibleActions
+	hand, table := cardSetOf(g.Hands[g.TurnPlayerID].Cards), cardSetOf(g.TableCards)
+	if hand.len() == len(g.Hands[g.TurnPlayerID].Cards) && table.len() == len(g.TableCards) {
+		p.moves = g.appendMovesFrom(movesBuf, hand, table)
+	} else {
+		p.throws = g.findAllThrows()
+	}
+
+	// Claiming the win is up to the player, even if the claim is false
+	p.claim = (ActionDeclareVictory{}).IsPossible(*g)
+	return p
+}
+
+// actions returns the possible actions of playerID
+func (p possibleActions) actions(playerID int) []Action {
+	// All captured cards share a single backing array
+	capturedCount := 0
+	for _, m := range p.moves {
+		capturedCount += m.captured.len()
+	}
+	captured := make([]Card, 0, capturedCount)
+
+	actions := make([]Action, 0, len(p.moves)+len(p.throws)+1)
+	for _, m := range p.moves {
+		if m.captured == 0 {
+			actions = append(actions, newActionThrowCard(cardsByIndex[m.card], []Card{}))
+			continue
 		}
+		start := len(captured)
+		captured = m.captured.appendCards(captured)
+		actions = append(actions, newActionThrowCard(cardsByIndex[m.card], captured[start:len(captured):len(captured)]))
+	}
+	actions = append(actions, p.throws...)
+	if p.claim {
+		actions = append(actions, newActionDeclareVictory())
 	}
+	for i, name := range playerActNames {
+		if p.playerActs[i] {
+			actions = append(actions, newPlayerAct(name, playerID))
+		}
+	}
+	return actions
+}
 
-	// If no valid combinations exist for any card, allow simple throws
-	if !hasValidCombinations {
-		for _, card := range g.Hands[g.TurnPlayerID].Cards {
-			actions = append(actions, newActionThrowCard(card, []Card{}))
+// possibleActionsJSON returns the serialized actions that playerID may run now,
+// exactly as _serializeActions(g.CalculatePossibleActionsFor(playerID)) would,
+// but without building the actions first.
+func (g *GameState) possibleActionsJSON(playerID int) []json.RawMessage {
+	var movesBuf [64]move
+	p := g.possibleActionsFor(playerID, movesBuf[:0])
+	if p.throws != nil || len(p.moves) > len(movesBuf) {
+		return _serializeActions(p.actions(playerID))
+	}
+
+	// All serialized actions share a single buffer. Besides the moves, there
+	// may be a victory claim and the actions that may be run out of turn.
+	var ends [len(movesBuf) + 1 + len(playerActNames)]int
+	endsCount := 0
+	size := (1 + len(playerActNames)) * maxPlayerActJSONLen
+	for _, m := range p.moves {
+		size += maxMoveJSONLen(m)
+	}
+	bs := make([]byte, 0, size)
+	for _, m := range p.moves {
+		bs = appendMoveJSON(bs, m)
+		ends[endsCount] = len(bs)
+		endsCount++
+	}
+	if p.claim {
+		bs = append(bs, `{"name":"`+DECLARE_VICTORY+`"}`...)
+		ends[endsCount] = len(bs)
+		endsCount++
+	}
+	for i, name := range playerActNames {
+		if p.playerActs[i] {
+			bs = appendPlayerActJSON(bs, name, playerID)
+			ends[endsCount] = len(bs)
+			endsCount++
 		}
 	}
 
+	actions := make([]json.RawMessage, endsCount)
+	start := 0
+	for i, end := range ends[:endsCount] {
+		actions[i] = json.RawMessage(bs[start:end:end])
+		start = end
+	}
 	return actions
 }
 
-var (
-	errActionNotPossible = errors.New("action not possible")
-	errGameIsEnded       = errors.New("game is ended")
-)
+// isPlayerActPossible returns true if playerID may run the named action that may be run out of turn
+func (g *GameState) isPlayerActPossible(name string, playerID int) bool {
+	a := playerAct{act: act{Name: name}, PlayerID: playerID}
+	switch name {
+	case RESIGN:
+		return ActionResign{a}.IsPossible(*g)
+	case OFFER_DRAW:
+		return ActionOfferDraw{a}.IsPossible(*g)
+	case ACCEPT_DRAW:
+		return ActionAcceptDraw{a}.IsPossible(*g)
+	case DECLINE_DRAW:
+		return ActionDeclineDraw{a}.IsPossible(*g)
+	}
+	return false
+}
+
+// newPlayerAct creates the named action that may be run out of turn, by playerID
+func newPlayerAct(name string, playerID int) Action {
+	switch name {
+	case RESIGN:
+		return newActionResign(playerID)
+	case OFFER_DRAW:
+		return newActionOfferDraw(playerID)
+	case ACCEPT_DRAW:
+		return newActionAcceptDraw(playerID)
+	default:
+		return newActionDeclineDraw(playerID)
+	}
+}
 
 func _serializeActions(as []Action) []json.RawMessage {
 	_as := []json.RawMessage{}
@@ -399,6 +1051,10 @@ func _serializeActions(as []Action) []json.RawMessage {
 }
 
 func SerializeAction(action Action) []byte {
+	// The actions run on every move serialize themselves without reflection
+	if a, ok := action.(interface{ appendJSON([]byte) []byte }); ok {
+		return a.appendJSON(nil)
+	}
 	bs, _ := json.Marshal(action)
 	return bs
 }
@@ -417,6 +1073,18 @@ func DeserializeAction(bs []byte) (Action, error) {
 	switch actionName.Name {
 	case THROW_CARD:
 		action = &ActionThrowCard{}
+	case INITIAL_ESCOBA:
+		action = &ActionInitialEscoba{}
+	case DECLARE_VICTORY:
+		action = &ActionDeclareVictory{}
+	case RESIGN:
+		action = &ActionResign{}
+	case OFFER_DRAW:
+		action = &ActionOfferDraw{}
+	case ACCEPT_DRAW:
+		action = &ActionAcceptDraw{}
+	case DECLINE_DRAW:
+		action = &ActionDeclineDraw{}
 	default:
 		return nil, fmt.Errorf("unknown action type %v", actionName.Name)
 	}
@@ -454,10 +1122,24 @@ func (g *GameState) TableCardsString() string {
 
 func (g *GameState) GameStateString() string {
 	result := fmt.Sprintf("=== Round %d, Player %d's turn ===\n", g.RoundNumber, g.TurnPlayerID)
-	result += fmt.Sprintf("Scores: P0=%d, P1=%d\n", g.Scores[0], g.Scores[1])
-	result += fmt.Sprintf("Escobas: P0=%d, P1=%d\n", g.Escobas[0], g.Escobas[1])
-	result += fmt.Sprintf("Player 0 hand: %s\n", g.Hands[0].String())
-	result += fmt.Sprintf("Player 1 hand: %s\n", g.Hands[1].String())
+	// Scores are kept by side, so in team mode they're printed by team
+	side := "P"
+	if g.rules().Teams {
+		side = "T"
+	}
+	scores := []string{}
+	for _, sideID := range g.sideIDs() {
+		scores = append(scores, fmt.Sprintf("%s%d=%d", side, sideID, g.Scores[sideID]))
+	}
+	escobas := []string{}
+	for _, playerID := range g.PlayerIDs() {
+		escobas = append(escobas, fmt.Sprintf("P%d=%d", playerID, g.Escobas[playerID]))
+	}
+	result += fmt.Sprintf("Scores: %s\n", strings.Join(scores, ", "))
+	result += fmt.Sprintf("Escobas: %s\n", strings.Join(escobas, ", "))
+	for _, playerID := range g.PlayerIDs() {
+		result += fmt.Sprintf("Player %d hand: %s\n", playerID, g.Hands[playerID].String())
+	}
 	result += fmt.Sprintf("%s\n", g.TableCardsString())
 	return result
 }
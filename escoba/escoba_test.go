@@ -1,8 +1,13 @@
 package escoba
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"math/rand"
+	"reflect"
 	"slices"
+	"strings"
 	"testing"
 	"time"
 )
@@ -1108,3 +1113,1833 @@ func combinationsEqual(a, b []Card) bool {
 	}
 	return true
 }
+
+func TestSeedReproducesDeals(t *testing.T) {
+	gs1 := New(WithSeed(42))
+	gs2 := New(WithSeed(42))
+
+	if gs1.Seed != 42 {
+		t.Errorf("Expected seed 42 to be recorded, got %d", gs1.Seed)
+	}
+
+	// Play both games with the same (first possible) actions; deals must match in every set
+	for !gs1.IsEnded {
+		if !slices.Equal(gs1.Hands[0].Cards, gs2.Hands[0].Cards) ||
+			!slices.Equal(gs1.Hands[1].Cards, gs2.Hands[1].Cards) ||
+			!sameCards(gs1.TableCards, gs2.TableCards) {
+			t.Fatalf("Games with the same seed diverged in set %d, round %d", gs1.SetNumber, gs1.RoundNumber)
+		}
+		action := gs1.CalculatePossibleActions()[0]
+		if err := gs1.RunAction(action); err != nil {
+			t.Fatalf("Error running action on first game: %v", err)
+		}
+		if err := gs2.RunAction(action); err != nil {
+			t.Fatalf("Error running action on second game: %v", err)
+		}
+	}
+
+	if !gs2.IsEnded || gs1.Scores[0] != gs2.Scores[0] || gs1.Scores[1] != gs2.Scores[1] {
+		t.Errorf("Expected identical final results, got %v and %v", gs1.Scores, gs2.Scores)
+	}
+}
+
+func TestWithCardOrder(t *testing.T) {
+	cards := SpanishCards()
+	slices.Reverse(cards)
+
+	gs := New(WithCardOrder(cards))
+
+	// Hands and table are dealt in order, and then sorted canonically
+	if !slices.Equal(gs.Hands[0].Cards, sortedCards(cards[0:3])) {
+		t.Errorf("Expected player 0 hand %v, got %v", sortedCards(cards[0:3]), gs.Hands[0].Cards)
+	}
+	if !slices.Equal(gs.Hands[1].Cards, sortedCards(cards[3:6])) {
+		t.Errorf("Expected player 1 hand %v, got %v", sortedCards(cards[3:6]), gs.Hands[1].Cards)
+	}
+	if !slices.Equal(gs.TableCards, sortedCards(cards[6:10])) {
+		t.Errorf("Expected table %v, got %v", sortedCards(cards[6:10]), gs.TableCards)
+	}
+	if !slices.Equal(gs.deck.cards, cards[10:]) {
+		t.Errorf("Expected the rest of the deck to follow the given order")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected WithCardOrder to panic with an incomplete deck")
+		}
+	}()
+	WithCardOrder(cards[1:])
+}
+
+// sameCards reports whether a and b contain the same cards, in any order
+func sameCards(a, b []Card) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, card := range a {
+		if !slices.Contains(b, card) {
+			return false
+		}
+	}
+	return true
+}
+
+func TestViewForRedactsHiddenInformation(t *testing.T) {
+	gs := New(WithSeed(7))
+
+	view := gs.ViewFor(1)
+
+	if !slices.Equal(view.Hands[1].Cards, gs.Hands[1].Cards) {
+		t.Errorf("Expected player 1 to see their own hand %v, got %v", gs.Hands[1].Cards, view.Hands[1].Cards)
+	}
+	if len(view.Hands[0].Cards) != 0 || view.Hands[0].Len() != 3 {
+		t.Errorf("Expected opponent hand to be redacted to 3 hidden cards, got %+v", view.Hands[0])
+	}
+	if view.deck != nil || view.Seed != 0 {
+		t.Error("Expected deck and seed to be hidden in view")
+	}
+	if view.DeckCount != len(gs.deck.cards) {
+		t.Errorf("Expected deck count %d, got %d", len(gs.deck.cards), view.DeckCount)
+	}
+	for _, bs := range view.PossibleActions {
+		if action, _ := DeserializeAction(bs); action == nil || action.GetName() == THROW_CARD {
+			t.Errorf("Expected only out of turn actions for player 1 on player 0's turn, got %s", bs)
+		}
+	}
+	if len(gs.ViewFor(0).PossibleActions) != len(gs.PossibleActions) {
+		t.Error("Expected player 0 to see their possible actions")
+	}
+
+	spectator := gs.ViewFor(-1)
+	if spectator.Hands[0].Len() != 3 || spectator.Hands[1].Len() != 3 || len(spectator.Hands[0].Cards)+len(spectator.Hands[1].Cards) != 0 {
+		t.Error("Expected spectator view to hide both hands")
+	}
+
+	// Mutating the view must not affect the game
+	view.Hands[1].Cards[0] = Card{Suit: ORO, Number: 99}
+	view.Scores[0] = 99
+	if gs.Hands[1].Cards[0].Number == 99 || gs.Scores[0] == 99 {
+		t.Error("Expected view to share no state with the game")
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	gs := New(WithSeed(1234))
+	for i := 0; i < 10; i++ {
+		if err := gs.RunAction(gs.CalculatePossibleActions()[0]); err != nil {
+			t.Fatalf("Error running action: %v", err)
+		}
+	}
+
+	bs, err := json.Marshal(gs.Snapshot())
+	if err != nil {
+		t.Fatalf("Error marshalling snapshot: %v", err)
+	}
+	var snapshot Snapshot
+	if err := json.Unmarshal(bs, &snapshot); err != nil {
+		t.Fatalf("Error unmarshalling snapshot: %v", err)
+	}
+	restored, err := Restore(snapshot)
+	if err != nil {
+		t.Fatalf("Error restoring snapshot: %v", err)
+	}
+
+	if !reflect.DeepEqual(gs, restored) {
+		t.Fatalf("Expected restored game to equal the original\noriginal: %+v\nrestored: %+v", gs, restored)
+	}
+
+	// Both games must keep evolving identically, including across set transitions
+	for !gs.IsEnded {
+		action := gs.CalculatePossibleActions()[0]
+		if err := gs.RunAction(action); err != nil {
+			t.Fatalf("Error running action on original game: %v", err)
+		}
+		if err := restored.RunAction(action); err != nil {
+			t.Fatalf("Error running action on restored game: %v", err)
+		}
+	}
+	if !restored.IsEnded || !reflect.DeepEqual(gs.Scores, restored.Scores) {
+		t.Errorf("Expected identical final scores, got %v and %v", gs.Scores, restored.Scores)
+	}
+
+	for _, version := range []int{0, SnapshotVersion + 1} {
+		snapshot.Version = version
+		if _, err := Restore(snapshot); err == nil {
+			t.Errorf("Expected an error restoring a snapshot with version %d", version)
+		}
+	}
+}
+
+// versionOneSnapshot returns the snapshot as version 1 wrote it: without the
+// fields that version 2 added, and with only the rules that version 1 had.
+func versionOneSnapshot(t *testing.T, snapshot Snapshot) Snapshot {
+	var state map[string]any
+	if err := json.Unmarshal(snapshot.State, &state); err != nil {
+		t.Fatalf("Error unmarshalling state: %v", err)
+	}
+	for _, key := range []string{"winnerTeamID", "penalties", "drawOfferSideIDs", "endReason", "tieBreakSideIDs", "takebacksAllowed"} {
+		delete(state, key)
+	}
+	rules := state["rules"].(map[string]any)
+	for key := range rules {
+		if key != "targetScore" {
+			delete(rules, key)
+		}
+	}
+	bs, err := json.Marshal(state)
+	if err != nil {
+		t.Fatalf("Error marshalling state: %v", err)
+	}
+	snapshot.Version = 1
+	snapshot.State = bs
+	if snapshot.Initial != nil {
+		initial := versionOneSnapshot(t, *snapshot.Initial)
+		snapshot.Initial = &initial
+	}
+	return snapshot
+}
+
+func TestRestoreVersionOneSnapshot(t *testing.T) {
+	rules := DefaultRules()
+	rules.TargetScore = 21
+	gs := New(WithSeed(5), WithRules(rules))
+	for i := 0; i < 10; i++ {
+		if err := gs.RunAction(gs.CalculatePossibleActions()[0]); err != nil {
+			t.Fatalf("Error running action: %v", err)
+		}
+	}
+
+	restored, err := Restore(versionOneSnapshot(t, gs.Snapshot()))
+	if err != nil {
+		t.Fatalf("Error restoring a version 1 snapshot: %v", err)
+	}
+	if restored.Rules != rules || restored.WinnerTeamID != -1 || !reflect.DeepEqual(restored.Penalties, map[int]int{0: 0, 1: 0}) {
+		t.Errorf("Expected the missing fields to take their defaults, got rules %+v, winner team %d and penalties %v", restored.Rules, restored.WinnerTeamID, restored.Penalties)
+	}
+	if err := restored.Validate(); err != nil {
+		t.Errorf("Expected the restored game to be valid, including its initial deal: %v", err)
+	}
+	for !restored.IsEnded {
+		if err := restored.RunAction(restored.CalculatePossibleActions()[0]); err != nil {
+			t.Fatalf("Error running action on the restored game: %v", err)
+		}
+	}
+}
+
+func TestReplayFromSeed(t *testing.T) {
+	gs := New(WithSeed(99))
+	for !gs.IsEnded {
+		if err := gs.RunAction(gs.CalculatePossibleActions()[0]); err != nil {
+			t.Fatalf("Error running action: %v", err)
+		}
+	}
+
+	replay, err := NewReplayFromSeed(gs.Seed, gs.Actions, gs.ActionOwnerPlayerIDs)
+	if err != nil {
+		t.Fatalf("Error creating replay: %v", err)
+	}
+	if err := replay.Verify(); err != nil {
+		t.Fatalf("Expected replay to verify, got %v", err)
+	}
+
+	if err := replay.Seek(replay.Len()); err != nil {
+		t.Fatalf("Error seeking to the end: %v", err)
+	}
+	final := replay.State()
+	if !final.IsEnded || !reflect.DeepEqual(final.Scores, gs.Scores) || final.WinnerPlayerID != gs.WinnerPlayerID {
+		t.Errorf("Expected replayed final scores %v, got %v", gs.Scores, final.Scores)
+	}
+
+	if err := replay.Backward(); err != nil {
+		t.Fatalf("Error stepping backward: %v", err)
+	}
+	if replay.Index() != replay.Len()-1 || replay.State().IsEnded {
+		t.Errorf("Expected to be one action before the end, at index %d", replay.Index())
+	}
+	if err := replay.Seek(0); err != nil || len(replay.State().Actions) != 0 {
+		t.Errorf("Expected to seek back to the initial deal, got err %v", err)
+	}
+}
+
+func TestReplayReportsFirstBadAction(t *testing.T) {
+	gs := New(WithSeed(5))
+	for i := 0; i < 6; i++ {
+		if err := gs.RunAction(gs.CalculatePossibleActions()[0]); err != nil {
+			t.Fatalf("Error running action: %v", err)
+		}
+	}
+
+	// An action with a card that was never dealt is illegal
+	actions := append([]json.RawMessage{}, gs.Actions...)
+	actions[3] = SerializeAction(newActionThrowCard(Card{Suit: ORO, Number: 99}, []Card{}))
+
+	replay, err := NewReplayFromSeed(gs.Seed, actions, gs.ActionOwnerPlayerIDs)
+	if err != nil {
+		t.Fatalf("Error creating replay: %v", err)
+	}
+	err = replay.Seek(replay.Len())
+	var replayErr *ReplayError
+	if !errors.As(err, &replayErr) || replayErr.Index != 3 {
+		t.Fatalf("Expected a ReplayError at index 3, got %v", err)
+	}
+	if replay.Index() != 3 {
+		t.Errorf("Expected replay to stop at the last good state (3), got %d", replay.Index())
+	}
+
+	// Recorded owners that don't match the turn order diverge
+	owners := append([]int{}, gs.ActionOwnerPlayerIDs...)
+	owners[1] = owners[0]
+	replay, _ = NewReplayFromSeed(gs.Seed, gs.Actions, owners)
+	if err := replay.Verify(); !errors.As(err, &replayErr) || replayErr.Index != 1 {
+		t.Errorf("Expected a ReplayError at index 1, got %v", err)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	gs := New(WithSeed(2024))
+
+	// Record the game after every action, then play until the end of the game,
+	// so undoing crosses round and set transitions and the set scoring
+	var history []GameState
+	for !gs.IsEnded {
+		snapshot, err := Restore(gs.Snapshot())
+		if err != nil {
+			t.Fatalf("Error restoring snapshot: %v", err)
+		}
+		history = append(history, *snapshot)
+		if err := gs.RunAction(gs.CalculatePossibleActions()[0]); err != nil {
+			t.Fatalf("Error running action: %v", err)
+		}
+	}
+
+	for i := len(history) - 1; i >= 0; i-- {
+		if err := gs.Undo(); err != nil {
+			t.Fatalf("Error undoing action %d: %v", i, err)
+		}
+		expected := history[i]
+		if len(gs.Actions) != len(expected.Actions) || gs.IsEnded ||
+			gs.SetNumber != expected.SetNumber || gs.RoundNumber != expected.RoundNumber ||
+			gs.TurnPlayerID != expected.TurnPlayerID || gs.LastCapturerPlayerID != expected.LastCapturerPlayerID ||
+			!reflect.DeepEqual(gs.Scores, expected.Scores) || !reflect.DeepEqual(gs.Escobas, expected.Escobas) ||
+			!reflect.DeepEqual(gs.Piles, expected.Piles) || !reflect.DeepEqual(gs.Hands, expected.Hands) ||
+			!sameCards(gs.TableCards, expected.TableCards) || !slices.Equal(gs.deck.cards, expected.deck.cards) {
+			t.Fatalf("Undoing action %d didn't restore the previous state\nexpected: %s\ngot: %s", i, expected.GameStateString(), gs.GameStateString())
+		}
+	}
+
+	if err := gs.Undo(); err == nil {
+		t.Error("Expected an error undoing with no actions")
+	}
+}
+
+func TestUndoTo(t *testing.T) {
+	gs := New(WithSeed(3))
+	for i := 0; i < 8; i++ {
+		if err := gs.RunAction(gs.CalculatePossibleActions()[0]); err != nil {
+			t.Fatalf("Error running action: %v", err)
+		}
+	}
+	owner := gs.ActionOwnerPlayerIDs[2]
+
+	if err := gs.UndoTo(2); err != nil {
+		t.Fatalf("Error undoing to action 2: %v", err)
+	}
+	if len(gs.Actions) != 2 || gs.TurnPlayerID != owner {
+		t.Errorf("Expected 2 actions and player %d's turn, got %d actions and player %d's turn", owner, len(gs.Actions), gs.TurnPlayerID)
+	}
+	if err := gs.UndoTo(3); err == nil {
+		t.Error("Expected an error undoing to a future action")
+	}
+
+	// A restored game can still undo
+	restored, err := Restore(gs.Snapshot())
+	if err != nil {
+		t.Fatalf("Error restoring snapshot: %v", err)
+	}
+	if err := restored.UndoTo(0); err != nil || len(restored.Actions) != 0 {
+		t.Errorf("Expected restored game to undo to the initial deal, got %v", err)
+	}
+}
+
+func TestCustomRules(t *testing.T) {
+	rules := DefaultRules()
+	rules.TargetScore = 31
+	rules.HandSize = 2
+	rules.InitialTableSize = 0
+
+	gs := New(WithSeed(11), WithRules(rules))
+	if len(gs.Hands[0].Cards) != 2 || len(gs.Hands[1].Cards) != 2 || len(gs.TableCards) != 0 {
+		t.Fatalf("Expected hands of 2 and an empty table, got %v, %v and %v", gs.Hands[0], gs.Hands[1], gs.TableCards)
+	}
+
+	for !gs.IsEnded {
+		if err := gs.RunAction(gs.CalculatePossibleActions()[0]); err != nil {
+			t.Fatalf("Error running action: %v", err)
+		}
+	}
+	if gs.Scores[0] < 31 && gs.Scores[1] < 31 {
+		t.Errorf("Expected a player to reach 31 points, got %v", gs.Scores)
+	}
+	if gs.Rules != rules {
+		t.Errorf("Expected rules to be kept in the game state, got %+v", gs.Rules)
+	}
+}
+
+func TestRulesValidate(t *testing.T) {
+	if err := DefaultRules().Validate(); err != nil {
+		t.Errorf("Expected default rules to be valid, got %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(*Rules)
+	}{
+		{"zero target score", func(r *Rules) { r.TargetScore = 0 }},
+		{"zero hand size", func(r *Rules) { r.HandSize = 0 }},
+		{"negative table size", func(r *Rules) { r.InitialTableSize = -1 }},
+		{"capture sum too small", func(r *Rules) { r.CaptureSum = 1 }},
+		{"unknown tie rule", func(r *Rules) { r.TieRule = "coin_toss" }},
+		{"cards left undealt", func(r *Rules) { r.HandSize = 4 }},
+	}
+	for _, tt := range tests {
+		rules := DefaultRules()
+		tt.modify(&rules)
+		if err := rules.Validate(); err == nil {
+			t.Errorf("Expected rules with %s to be invalid", tt.name)
+		}
+	}
+}
+
+func TestOptionalCapture(t *testing.T) {
+	rules := DefaultRules()
+	rules.OptionalCapture = true
+	gs := New(WithRules(rules))
+
+	gs.TurnPlayerID = 0
+	gs.Hands[0] = &Hand{Cards: []Card{{Suit: ORO, Number: 5}}}
+	gs.TableCards = []Card{{Suit: COPA, Number: 12}, {Suit: BASTO, Number: 4}} // 5 + 10 = 15
+
+	actions := gs.CalculatePossibleActions()
+	if len(actions) != 2 {
+		t.Fatalf("Expected a capture and a plain throw, got %v", actions)
+	}
+	throw := newActionThrowCard(Card{Suit: ORO, Number: 5}, []Card{})
+	if !throw.IsPossible(*gs) {
+		t.Error("Expected a plain throw to be possible when capturing is optional")
+	}
+
+	gs.Rules.OptionalCapture = false
+	if throw.IsPossible(*gs) {
+		t.Error("Expected a plain throw not to be possible when capturing is mandatory")
+	}
+	if len(gs.CalculatePossibleActions()) != 1 {
+		t.Error("Expected only the capture when capturing is mandatory")
+	}
+}
+
+func TestBotAvoidsOpeningEscobaWhenCaptureIsOptional(t *testing.T) {
+	rules := DefaultRules()
+	rules.OptionalCapture = true
+	gs := New(WithRules(rules))
+
+	// Capturing [12 de copa] with the 5 leaves the 6 alone, which the opponent can sweep with an 11.
+	// Throwing the 5 instead leaves a table summing to 21, which can't be cleared with one card.
+	gs.TurnPlayerID = 1
+	gs.Hands[1] = &Hand{Cards: []Card{{Suit: ORO, Number: 5}}}
+	gs.TableCards = []Card{{Suit: COPA, Number: 12}, {Suit: BASTO, Number: 6}}
+
+	action := NewBot().ChooseAction(*gs).(ActionThrowCard)
+	if action.IsCapture() {
+		t.Errorf("Expected the bot to throw to the table instead of opening an escoba, got %v", action)
+	}
+}
+
+// mirrorSeats swaps everything that belongs to seats 0 and 1 in a two-player game
+func mirrorSeats(gs *GameState) *GameState {
+	mirrored := gs.Clone()
+	mirrored.Hands[0], mirrored.Hands[1] = mirrored.Hands[1], mirrored.Hands[0]
+	mirrored.Piles[0], mirrored.Piles[1] = mirrored.Piles[1], mirrored.Piles[0]
+	mirrored.Escobas[0], mirrored.Escobas[1] = mirrored.Escobas[1], mirrored.Escobas[0]
+	mirrored.Scores[0], mirrored.Scores[1] = mirrored.Scores[1], mirrored.Scores[0]
+	mirrored.TurnPlayerID = 1 - gs.TurnPlayerID
+	return mirrored
+}
+
+func TestBotPlaysTheSameFromEitherSeat(t *testing.T) {
+	for _, rules := range []Rules{DefaultRules(), scopaRules()} {
+		for seed := int64(0); seed < 4; seed++ {
+			gs := New(WithSeed(seed), WithRules(rules))
+			for !gs.IsEnded {
+				action := NewBot().ChooseAction(*gs)
+				if mirrored := NewBot().ChooseAction(*mirrorSeats(gs)); !reflect.DeepEqual(action, mirrored) {
+					t.Fatalf("Expected the bot to choose %v from seat %d too, got %v", action, 1-gs.TurnPlayerID, mirrored)
+				}
+				if err := gs.RunAction(action); err != nil {
+					t.Fatalf("Error running %v: %v", action, err)
+				}
+			}
+		}
+	}
+
+	// The bot looks at the piles of the player whose turn it is, whatever their seat
+	gs := New()
+	gs.Piles[1] = SpanishCards()
+	for playerID, cares := range map[int]int{0: 1, 1: 0} {
+		gs.TurnPlayerID = playerID
+		if caresAboutCardCount(*gs) != cares || caresAboutOroCount(*gs) != cares || caresAboutSetenta(*gs) != cares {
+			t.Errorf("Expected player %d to care about cards, oros and la setenta: %d, got %d, %d and %d", playerID, cares, caresAboutCardCount(*gs), caresAboutOroCount(*gs), caresAboutSetenta(*gs))
+		}
+	}
+}
+
+func scopaRules() Rules {
+	rules := DefaultRules()
+	rules.Variant = VARIANT_SCOPA
+	rules.TargetScore = 11
+	return rules
+}
+
+func TestScopaCaptures(t *testing.T) {
+	gs := New(WithRules(scopaRules()))
+	gs.TurnPlayerID = 0
+	gs.Hands[0] = &Hand{Cards: []Card{{Suit: ORO, Number: 5}}}
+
+	// A single matching card must be taken before any combination
+	gs.TableCards = []Card{{Suit: COPA, Number: 5}, {Suit: BASTO, Number: 2}, {Suit: ESPADA, Number: 3}}
+	actions := gs.CalculatePossibleActions()
+	if len(actions) != 1 || !slices.Equal(actions[0].(ActionThrowCard).CapturedTableCards, []Card{{Suit: COPA, Number: 5}}) {
+		t.Errorf("Expected only the capture of the matching 5, got %v", actions)
+	}
+	combination := newActionThrowCard(Card{Suit: ORO, Number: 5}, []Card{{Suit: BASTO, Number: 2}, {Suit: ESPADA, Number: 3}})
+	if combination.IsPossible(*gs) {
+		t.Error("Expected capturing a combination to be impossible when a matching card is on the table")
+	}
+
+	// Without a matching card, combinations adding up to the card's value are captured
+	gs.TableCards = []Card{{Suit: BASTO, Number: 2}, {Suit: ESPADA, Number: 3}, {Suit: COPA, Number: 4}}
+	if !combination.IsPossible(*gs) {
+		t.Error("Expected capturing 2 + 3 with a 5 to be possible")
+	}
+	if err := gs.RunAction(combination); err != nil {
+		t.Fatalf("Error running action: %v", err)
+	}
+	if !slices.Equal(gs.TableCards, []Card{{Suit: COPA, Number: 4}}) {
+		t.Errorf("Expected only the 4 to remain on the table, got %v", gs.TableCards)
+	}
+}
+
+func TestScopaScoresPrimiera(t *testing.T) {
+	gs := New(WithRules(scopaRules()))
+	gs.Hands[0] = &Hand{Cards: []Card{}}
+	gs.Hands[1] = &Hand{Cards: []Card{}}
+	gs.TableCards = []Card{}
+	gs.Escobas = map[int]int{0: 0, 1: 0}
+
+	// Player 0: 7 + 6 + 1 + 5 = 21 + 18 + 16 + 15 = 70, and the settebello
+	// Player 1: 7s of three suits but no oro, so no primiera at all
+	gs.Piles[0] = []Card{{Suit: ORO, Number: 7}, {Suit: COPA, Number: 6}, {Suit: ESPADA, Number: 1}, {Suit: BASTO, Number: 5}}
+	gs.Piles[1] = []Card{{Suit: COPA, Number: 7}, {Suit: ESPADA, Number: 7}, {Suit: BASTO, Number: 7}, {Suit: BASTO, Number: 6}, {Suit: COPA, Number: 1}}
+
+	gs.scoreSet()
+	result := gs.LastSetResults
+
+	if result.PrimieraScores[0] != 70 || result.PrimieraScores[1] != 0 {
+		t.Errorf("Expected primiera scores 70 and 0, got %v", result.PrimieraScores)
+	}
+	// Player 0: most oros, settebello and primiera; player 1: most cards
+	if result.PointsAwarded[0] != 3 || result.PointsAwarded[1] != 1 {
+		t.Errorf("Expected 3 and 1 points awarded, got %v", result.PointsAwarded)
+	}
+}
+
+func TestScopaRandomGame(t *testing.T) {
+	gs := New(WithRules(scopaRules()))
+	for actionCount := 0; !gs.IsEnded; actionCount++ {
+		if actionCount > 1000 {
+			t.Fatal("Scopa game did not end within 1000 actions")
+		}
+		actions := gs.CalculatePossibleActions()
+		if err := gs.RunAction(actions[rand.Intn(len(actions))]); err != nil {
+			t.Fatalf("Error running action: %v", err)
+		}
+	}
+	if gs.Scores[0] < 11 && gs.Scores[1] < 11 {
+		t.Errorf("Expected a player to reach 11 points, got %v", gs.Scores)
+	}
+}
+
+func TestMultiplayerGames(t *testing.T) {
+	for _, players := range []int{3, 4} {
+		rules := DefaultRules()
+		rules.Players = players
+		gs := New(WithSeed(int64(players)), WithRules(rules))
+
+		if len(gs.Hands) != players {
+			t.Fatalf("Expected %d hands, got %d", players, len(gs.Hands))
+		}
+		for _, playerID := range gs.PlayerIDs() {
+			if len(gs.Hands[playerID].Cards) != 3 {
+				t.Errorf("Expected 3 cards in player %d hand, got %d", playerID, len(gs.Hands[playerID].Cards))
+			}
+		}
+
+		// Turns rotate around the table until the round is over
+		for i := 0; i < players; i++ {
+			if gs.TurnPlayerID != i {
+				t.Fatalf("Expected player %d's turn, got player %d's", i, gs.TurnPlayerID)
+			}
+			if err := gs.RunAction(gs.CalculatePossibleActions()[0]); err != nil {
+				t.Fatalf("Error running action: %v", err)
+			}
+		}
+
+		for actionCount := 0; !gs.IsEnded; actionCount++ {
+			if actionCount > 2000 {
+				t.Fatalf("%d-player game did not end within 2000 actions", players)
+			}
+			actions := gs.CalculatePossibleActions()
+			if err := gs.RunAction(actions[rand.Intn(len(actions))]); err != nil {
+				t.Fatalf("Error running action: %v", err)
+			}
+			if gs.SetFinished && !gs.IsEnded {
+				t.Fatalf("Expected a new set to start after scoring")
+			}
+		}
+
+		totalCards := len(gs.TableCards)
+		for _, playerID := range gs.PlayerIDs() {
+			totalCards += len(gs.Piles[playerID])
+		}
+		if totalCards != 40 {
+			t.Errorf("Expected all 40 cards to be dealt in a %d-player game, got %d", players, totalCards)
+		}
+		if gs.WinnerPlayerID != uniqueMaxID(gs.Scores) {
+			t.Errorf("Expected winner %d, got %d", uniqueMaxID(gs.Scores), gs.WinnerPlayerID)
+		}
+	}
+}
+
+func TestMultiplayerScoringTies(t *testing.T) {
+	rules := DefaultRules()
+	rules.Players = 3
+	gs := New(WithRules(rules))
+	for _, playerID := range gs.PlayerIDs() {
+		gs.Hands[playerID] = &Hand{Cards: []Card{}}
+		gs.Escobas[playerID] = 0
+	}
+	gs.TableCards = []Card{}
+
+	// Players 0 and 1 tie for most cards, player 2 has the most oros and the 7 of oro
+	gs.Piles[0] = []Card{{Suit: COPA, Number: 1}, {Suit: COPA, Number: 2}, {Suit: COPA, Number: 3}}
+	gs.Piles[1] = []Card{{Suit: BASTO, Number: 1}, {Suit: BASTO, Number: 2}, {Suit: BASTO, Number: 3}}
+	gs.Piles[2] = []Card{{Suit: ORO, Number: 7}, {Suit: ORO, Number: 1}}
+
+	gs.scoreSet()
+
+	expected := map[int]int{0: 0, 1: 0, 2: 2}
+	if !reflect.DeepEqual(gs.LastSetResults.PointsAwarded, expected) {
+		t.Errorf("Expected points awarded %v, got %v", expected, gs.LastSetResults.PointsAwarded)
+	}
+	if gs.RoundTurnPlayerID != 1 {
+		t.Errorf("Expected mano to pass to player 1, got player %d", gs.RoundTurnPlayerID)
+	}
+}
+
+func teamRules() Rules {
+	rules := DefaultRules()
+	rules.Players = 4
+	rules.Teams = true
+	return rules
+}
+
+func TestTeamsPoolPilesAndEscobas(t *testing.T) {
+	gs := New(WithRules(teamRules()))
+	for _, playerID := range gs.PlayerIDs() {
+		gs.Hands[playerID] = &Hand{Cards: []Card{}}
+		gs.Piles[playerID] = []Card{}
+		gs.Escobas[playerID] = 0
+	}
+	gs.TableCards = []Card{}
+
+	// Team 0 (players 0 and 2) pools 4 cards and 2 escobas; team 1 (players 1 and 3) has 3 cards and the 7 of oro
+	gs.Piles[0] = []Card{{Suit: COPA, Number: 1}, {Suit: COPA, Number: 2}}
+	gs.Piles[2] = []Card{{Suit: BASTO, Number: 1}, {Suit: BASTO, Number: 2}}
+	gs.Piles[1] = []Card{{Suit: ORO, Number: 7}, {Suit: ESPADA, Number: 1}}
+	gs.Piles[3] = []Card{{Suit: ESPADA, Number: 2}}
+	gs.Escobas[0] = 1
+	gs.Escobas[2] = 1
+
+	gs.scoreSet()
+	result := gs.LastSetResults
+
+	if !result.ByTeam || len(result.PointsAwarded) != 2 {
+		t.Fatalf("Expected results for 2 teams, got %+v", result)
+	}
+	if result.CardCounts[0] != 4 || result.CardCounts[1] != 3 || result.EscobasThisSet[0] != 2 {
+		t.Errorf("Expected pooled card counts 4 and 3 and 2 escobas for team 0, got %v and %v", result.CardCounts, result.EscobasThisSet)
+	}
+	// Team 0: 2 escobas + most cards; team 1: most oros + 7 of oro
+	if result.PointsAwarded[0] != 3 || result.PointsAwarded[1] != 2 {
+		t.Errorf("Expected 3 and 2 points awarded, got %v", result.PointsAwarded)
+	}
+	if gs.ScoreOf(2) != 3 || gs.ScoreOf(3) != 2 {
+		t.Errorf("Expected partners to share their team's score, got %d and %d", gs.ScoreOf(2), gs.ScoreOf(3))
+	}
+}
+
+func TestTeamsGame(t *testing.T) {
+	gs := New(WithSeed(10), WithRules(teamRules()))
+	for actionCount := 0; !gs.IsEnded; actionCount++ {
+		if actionCount > 2000 {
+			t.Fatal("Team game did not end within 2000 actions")
+		}
+		if err := gs.RunAction(gs.CalculatePossibleActions()[0]); err != nil {
+			t.Fatalf("Error running action: %v", err)
+		}
+	}
+
+	if err := gs.Validate(); err != nil {
+		t.Errorf("Expected a valid team game, got %v", err)
+	}
+	for _, playerID := range gs.PlayerIDs() {
+		if partnerID := gs.PartnerOf(playerID); partnerID != (playerID+2)%4 || gs.TeamOf(partnerID) != gs.TeamOf(playerID) || gs.TeamOf(gs.NextPlayerID(playerID)) == gs.TeamOf(playerID) {
+			t.Errorf("Expected player %d to sit across from their partner, got partner %d", playerID, partnerID)
+		}
+	}
+	if gs.WinnerPlayerID != -1 {
+		t.Errorf("Expected no winner player in team mode, got %d", gs.WinnerPlayerID)
+	}
+	if scores := fmt.Sprintf("Scores: T0=%d, T1=%d\n", gs.Scores[0], gs.Scores[1]); !strings.Contains(gs.GameStateString(), scores) {
+		t.Errorf("Expected the game state string to show the team scores, got %s", gs.GameStateString())
+	}
+	if gs.IsDraw() {
+		for _, playerID := range gs.PlayerIDs() {
+			if gs.IsWinner(playerID) {
+				t.Errorf("Expected no winners in a drawn team game, got player %d", playerID)
+			}
+		}
+	} else {
+		winner := gs.WinnerTeamID
+		if !gs.IsWinner(winner) || !gs.IsWinner(gs.PartnerOf(winner)) || gs.IsWinner(gs.NextPlayerID(winner)) {
+			t.Errorf("Expected both players of team %d and only them to be winners", winner)
+		}
+	}
+
+	rules := DefaultRules()
+	rules.Teams = true
+	if err := rules.Validate(); err == nil {
+		t.Error("Expected teams with 2 players to be invalid")
+	}
+}
+
+// deckWithInitialTable returns a card order that deals the given cards to the table
+// on the first round of a 2 player game
+func deckWithInitialTable(table []Card) []Card {
+	rest := slices.DeleteFunc(SpanishCards(), func(c Card) bool { return slices.Contains(table, c) })
+	order := append([]Card{}, rest[:6]...)
+	order = append(order, table...)
+	return append(order, rest[6:]...)
+}
+
+func TestInitialEscobaRules(t *testing.T) {
+	fifteen := []Card{{Suit: ORO, Number: 7}, {Suit: COPA, Number: 3}, {Suit: ESPADA, Number: 4}, {Suit: BASTO, Number: 1}}
+	splittableThirty := []Card{{Suit: ORO, Number: 7}, {Suit: COPA, Number: 10}, {Suit: ESPADA, Number: 12}, {Suit: BASTO, Number: 5}}
+	unsplittableThirty := []Card{{Suit: ORO, Number: 12}, {Suit: COPA, Number: 12}, {Suit: ESPADA, Number: 6}, {Suit: BASTO, Number: 4}}
+
+	tests := []struct {
+		name            string
+		table           []Card
+		initialEscoba   string
+		thirty          bool
+		expectedPlayer  int
+		expectedEscobas int
+	}{
+		{"mano", fifteen, INITIAL_ESCOBA_MANO, false, 0, 1},
+		{"dealer", fifteen, INITIAL_ESCOBA_DEALER, false, 1, 1},
+		{"none", fifteen, INITIAL_ESCOBA_NONE, false, -1, 0},
+		{"thirty disabled", splittableThirty, INITIAL_ESCOBA_MANO, false, -1, 0},
+		{"thirty", splittableThirty, INITIAL_ESCOBA_MANO, true, 0, 2},
+		{"thirty that can't be split", unsplittableThirty, INITIAL_ESCOBA_MANO, true, -1, 0},
+	}
+
+	for _, tt := range tests {
+		rules := DefaultRules()
+		rules.InitialEscoba = tt.initialEscoba
+		rules.InitialEscobaThirty = tt.thirty
+		gs := New(WithRules(rules), WithCardOrder(deckWithInitialTable(tt.table)))
+
+		if tt.expectedPlayer == -1 {
+			if len(gs.Actions) != 0 || !sameCards(gs.TableCards, tt.table) || gs.Escobas[0]+gs.Escobas[1] != 0 {
+				t.Errorf("%s: expected no initial escoba, got %d actions, table %v", tt.name, len(gs.Actions), gs.TableCards)
+			}
+			continue
+		}
+
+		if len(gs.TableCards) != 0 || gs.Escobas[tt.expectedPlayer] != tt.expectedEscobas || !sameCards(gs.Piles[tt.expectedPlayer], tt.table) {
+			t.Errorf("%s: expected player %d to sweep the table with %d escobas, got escobas %v and piles %v", tt.name, tt.expectedPlayer, tt.expectedEscobas, gs.Escobas, gs.Piles)
+		}
+		if len(gs.Actions) != 1 || gs.ActionOwnerPlayerIDs[0] != tt.expectedPlayer {
+			t.Fatalf("%s: expected the initial escoba to be recorded as an action of player %d, got %v", tt.name, tt.expectedPlayer, gs.ActionOwnerPlayerIDs)
+		}
+		action, err := DeserializeAction(gs.Actions[0])
+		if err != nil || action.GetName() != INITIAL_ESCOBA || action.IsPossible(*gs) {
+			t.Errorf("%s: expected a recorded initial escoba that players can't run, got %v (%v)", tt.name, action, err)
+		}
+	}
+
+	rules := DefaultRules()
+	rules.InitialEscoba = "whoever"
+	if rules.Validate() == nil {
+		t.Error("Expected an error validating an unknown initial escoba rule")
+	}
+}
+
+func TestReplayAndUndoSkipInitialEscoba(t *testing.T) {
+	table := []Card{{Suit: ORO, Number: 7}, {Suit: COPA, Number: 3}, {Suit: ESPADA, Number: 4}, {Suit: BASTO, Number: 1}}
+	order := deckWithInitialTable(table)
+	gs := New(WithCardOrder(order))
+	initial := gs.Snapshot()
+	if err := gs.RunAction(gs.CalculatePossibleActions()[0]); err != nil {
+		t.Fatalf("Error running action: %v", err)
+	}
+
+	restored, err := Restore(initial, WithCardOrder(order))
+	if err != nil {
+		t.Fatalf("Error restoring snapshot: %v", err)
+	}
+	replay, err := NewReplay(restored, gs.Actions, gs.ActionOwnerPlayerIDs, WithCardOrder(order))
+	if err != nil {
+		t.Fatalf("Error creating replay: %v", err)
+	}
+	if err := replay.Verify(); err != nil {
+		t.Errorf("Expected the replay to reproduce the recorded initial escoba, got %v", err)
+	}
+
+	if err := gs.Undo(); err != nil {
+		t.Fatalf("Error undoing action: %v", err)
+	}
+	if len(gs.Actions) != 1 || gs.Escobas[0] != 1 {
+		t.Errorf("Expected undo to keep the initial escoba, got %d actions and escobas %v", len(gs.Actions), gs.Escobas)
+	}
+	if err := gs.Undo(); err == nil {
+		t.Error("Expected an error undoing the initial escoba, which no player ran")
+	}
+}
+
+func TestLastCaptureNotEscoba(t *testing.T) {
+	for _, lastCaptureNotEscoba := range []bool{false, true} {
+		rules := DefaultRules()
+		rules.LastCaptureNotEscoba = lastCaptureNotEscoba
+		gs := New(WithRules(rules))
+
+		// The last throw of the set clears the table
+		gs.deck.cards = nil
+		gs.DeckCount = 0
+		gs.TurnPlayerID = 0
+		gs.Hands[0] = &Hand{Cards: []Card{{Suit: ORO, Number: 5}}}
+		gs.Hands[1] = &Hand{Cards: []Card{}}
+		gs.TableCards = []Card{{Suit: COPA, Number: 4}, {Suit: ESPADA, Number: 6}}
+		gs.Escobas[0], gs.Escobas[1] = 0, 0
+
+		action := newActionThrowCard(Card{Suit: ORO, Number: 5}, []Card{{Suit: COPA, Number: 4}, {Suit: ESPADA, Number: 6}}).(ActionThrowCard)
+		if action.IsEscoba(gs) == lastCaptureNotEscoba {
+			t.Errorf("LastCaptureNotEscoba=%v: expected IsEscoba to be %v", lastCaptureNotEscoba, !lastCaptureNotEscoba)
+		}
+
+		// Earlier in the set, clearing the table is always an escoba
+		gs.Hands[1] = &Hand{Cards: []Card{{Suit: BASTO, Number: 1}}}
+		if !action.IsEscoba(gs) {
+			t.Errorf("LastCaptureNotEscoba=%v: expected an escoba before the last throw of the set", lastCaptureNotEscoba)
+		}
+		gs.Hands[1] = &Hand{Cards: []Card{}}
+
+		if err := gs.RunAction(action); err != nil {
+			t.Fatalf("Error running action: %v", err)
+		}
+		expected := 1
+		if lastCaptureNotEscoba {
+			expected = 0
+		}
+		if gs.LastSetResults == nil || gs.LastSetResults.EscobasThisSet[0] != expected {
+			t.Errorf("LastCaptureNotEscoba=%v: expected %d escobas in the set result, got %v", lastCaptureNotEscoba, expected, gs.LastSetResults)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	m := NewMatch(3, WithSeed(7))
+
+	for games := 1; !m.IsEnded; games++ {
+		if games > 3 {
+			t.Fatalf("Expected a best of 3 match to end after at most 3 games")
+		}
+		if m.GameNumber != games || m.Game.RoundTurnPlayerID != (games-1)%2 {
+			t.Errorf("Expected game %d to start with player %d as mano, got game %d with mano %d", games, (games-1)%2, m.GameNumber, m.Game.RoundTurnPlayerID)
+		}
+		if games > 1 && m.Game.Seed != 7+int64(games-1) {
+			t.Errorf("Expected game %d to be seeded with %d, got %d", games, 7+int64(games-1), m.Game.Seed)
+		}
+
+		for !m.Game.IsEnded {
+			if err := m.RunAction(m.Game.CalculatePossibleActions()[0]); err != nil {
+				t.Fatalf("Error running action: %v", err)
+			}
+		}
+		if len(m.Results) != games {
+			t.Fatalf("Expected %d game results, got %d", games, len(m.Results))
+		}
+		if err := m.RunAction(newActionThrowCard(Card{Suit: ORO, Number: 1}, nil)); err == nil {
+			t.Errorf("Expected an error running an action on an ended game of the match")
+		}
+		if !m.IsEnded {
+			if err := m.NextGame(); err != nil {
+				t.Fatalf("Error starting the next game: %v", err)
+			}
+			if err := m.NextGame(); err == nil {
+				t.Errorf("Expected an error starting a game before the current one ended")
+			}
+		}
+	}
+
+	if m.Wins[0]+m.Wins[1] > len(m.Results) {
+		t.Errorf("Expected at most one win per game, got wins %v for %d games", m.Wins, len(m.Results))
+	}
+	if !m.IsDraw() && m.Wins[m.WinnerPlayerID] < 2 && len(m.Results) < 3 {
+		t.Errorf("Expected the winner to have won 2 games to end the match early, got wins %v", m.Wins)
+	}
+	if m.IsWinner(0) == m.IsWinner(1) && !m.IsDraw() {
+		t.Errorf("Expected exactly one winner, got wins %v", m.Wins)
+	}
+	if err := m.NextGame(); err == nil {
+		t.Errorf("Expected an error starting a game after the match ended")
+	}
+
+	bs, err := json.Marshal(m.ViewFor(0))
+	if err != nil {
+		t.Fatalf("Error marshalling match: %v", err)
+	}
+	var view Match
+	if err := json.Unmarshal(bs, &view); err != nil {
+		t.Fatalf("Error unmarshalling match: %v", err)
+	}
+	if view.Seed != 0 || !view.IsEnded || len(view.Results) != len(m.Results) || !reflect.DeepEqual(view.Wins, m.Wins) {
+		t.Errorf("Expected the match view to keep the results and hide the seed, got %+v", view)
+	}
+
+	// A match restored mid-game plays on exactly like the original, by its rules
+	rules := DefaultRules()
+	rules.Players = 3
+	rules.TargetScore = 1
+	m = NewMatch(3, WithRules(rules), WithTakebacks())
+	for i := 0; i < 4; i++ {
+		if err := m.RunAction(m.Game.CalculatePossibleActions()[0]); err != nil {
+			t.Fatalf("Error running action: %v", err)
+		}
+	}
+	if bs, err = json.Marshal(m.Snapshot()); err != nil {
+		t.Fatalf("Error marshalling match snapshot: %v", err)
+	}
+	var snapshot MatchSnapshot
+	if err := json.Unmarshal(bs, &snapshot); err != nil {
+		t.Fatalf("Error unmarshalling match snapshot: %v", err)
+	}
+	restored, err := RestoreMatch(snapshot)
+	if err != nil {
+		t.Fatalf("Error restoring match: %v", err)
+	}
+	// Both matches play the same actions, which also must be possible on the restored one
+	for !m.IsEnded {
+		for !m.Game.IsEnded {
+			action := m.Game.CalculatePossibleActions()[0]
+			if err := m.RunAction(action); err != nil {
+				t.Fatalf("Error running action: %v", err)
+			}
+			if err := restored.RunAction(action); err != nil {
+				t.Fatalf("Error running action on the restored match: %v", err)
+			}
+		}
+		if m.IsEnded {
+			break
+		}
+		if err := m.NextGame(); err != nil {
+			t.Fatalf("Error starting the next game: %v", err)
+		}
+		if err := restored.NextGame(); err != nil {
+			t.Fatalf("Error starting the next game of the restored match: %v", err)
+		}
+		if restored.Game.Rules != rules || !restored.Game.TakebacksAllowed || restored.Game.Seed != m.Game.Seed {
+			t.Errorf("Expected the restored match to keep the rules, takebacks and seeds, got %+v", restored.Game.Rules)
+		}
+	}
+	if !restored.IsEnded || !reflect.DeepEqual(restored.Results, m.Results) {
+		t.Errorf("Expected the restored match to play on like the original, got results %+v and %+v", restored.Results, m.Results)
+	}
+}
+
+// scoreTiedSet scores a set in which player 0 gets 2 points (most oros and the
+// 7 of oro) and player 1 gets 1 (most cards), or the other way around if swap
+func scoreTiedSet(gs *GameState, swap bool) {
+	two, one := 0, 1
+	if swap {
+		two, one = 1, 0
+	}
+	for _, playerID := range gs.PlayerIDs() {
+		gs.Hands[playerID] = &Hand{Cards: []Card{}}
+		gs.Escobas[playerID] = 0
+	}
+	gs.TableCards = []Card{}
+	gs.Piles[two] = []Card{{Suit: ORO, Number: 7}}
+	gs.Piles[one] = []Card{{Suit: COPA, Number: 1}, {Suit: COPA, Number: 2}, {Suit: BASTO, Number: 1}}
+	gs.scoreSet()
+}
+
+func TestTieRules(t *testing.T) {
+	newGame := func(tieRule string, scores map[int]int) *GameState {
+		rules := DefaultRules()
+		rules.TieRule = tieRule
+		// Deal a table without an escoba, which would settle a sudden death
+		gs := New(WithRules(rules), WithCardOrder(deckWithInitialTable([]Card{{COPA, 1}, {COPA, 2}, {ESPADA, 3}, {BASTO, 4}})))
+		gs.Scores = scores
+		return gs
+	}
+
+	// Player 0 goes from 13 to 15 and player 1 from 14 to 15
+	for _, tieRule := range []string{TIE_RULE_HIGHER_SCORE, TIE_RULE_DRAW} {
+		gs := newGame(tieRule, map[int]int{0: 13, 1: 14})
+		scoreTiedSet(gs, false)
+		if !gs.IsEnded || !gs.IsDraw() || gs.EndReason != END_REASON_TARGET_SCORE {
+			t.Errorf("%s: expected a draw on a tie for the highest score, got ended=%v winner=%d reason=%q", tieRule, gs.IsEnded, gs.WinnerPlayerID, gs.EndReason)
+		}
+	}
+
+	// Player 0 goes from 14 to 16 and player 1 from 14 to 15
+	gs := newGame(TIE_RULE_HIGHER_SCORE, map[int]int{0: 14, 1: 14})
+	scoreTiedSet(gs, false)
+	if !gs.IsWinner(0) || gs.IsDraw() {
+		t.Errorf("Expected the higher score to win, got winner %d with scores %v", gs.WinnerPlayerID, gs.Scores)
+	}
+	gs = newGame(TIE_RULE_DRAW, map[int]int{0: 14, 1: 14})
+	scoreTiedSet(gs, false)
+	if !gs.IsDraw() {
+		t.Errorf("Expected a draw when both players reach the target score, got winner %d", gs.WinnerPlayerID)
+	}
+
+	// Extra sets are played until a single player leads
+	gs = newGame(TIE_RULE_EXTRA_SETS, map[int]int{0: 13, 1: 14})
+	scoreTiedSet(gs, false)
+	if gs.IsEnded || !slices.Equal(gs.TieBreakSideIDs, []int{0, 1}) || gs.SetNumber != 2 {
+		t.Fatalf("Expected a tie-break with an extra set, got ended=%v tie-break=%v set=%d", gs.IsEnded, gs.TieBreakSideIDs, gs.SetNumber)
+	}
+	scoreTiedSet(gs, true)
+	if !gs.IsWinner(1) || gs.EndReason != END_REASON_EXTRA_SETS {
+		t.Errorf("Expected player 1 to win on extra sets, got winner %d reason %q with scores %v", gs.WinnerPlayerID, gs.EndReason, gs.Scores)
+	}
+
+	// In sudden death, the first escoba wins
+	gs = newGame(TIE_RULE_SUDDEN_DEATH, map[int]int{0: 13, 1: 14})
+	scoreTiedSet(gs, false)
+	if gs.IsEnded || !slices.Equal(gs.TieBreakSideIDs, []int{0, 1}) {
+		t.Fatalf("Expected a sudden death tie-break, got ended=%v tie-break=%v", gs.IsEnded, gs.TieBreakSideIDs)
+	}
+	gs.TurnPlayerID = 1
+	gs.Hands[1] = &Hand{Cards: []Card{{Suit: ORO, Number: 5}, {Suit: ORO, Number: 1}}}
+	gs.TableCards = []Card{{Suit: COPA, Number: 4}, {Suit: ESPADA, Number: 6}}
+	if err := gs.RunAction(newActionThrowCard(Card{Suit: ORO, Number: 5}, []Card{{Suit: COPA, Number: 4}, {Suit: ESPADA, Number: 6}})); err != nil {
+		t.Fatalf("Error running action: %v", err)
+	}
+	if !gs.IsWinner(1) || gs.EndReason != END_REASON_SUDDEN_DEATH || gs.Scores[1] != 16 {
+		t.Errorf("Expected player 1 to win on a sudden death escoba, got winner %d reason %q with scores %v", gs.WinnerPlayerID, gs.EndReason, gs.Scores)
+	}
+	if len(gs.TieBreakSideIDs) != 0 || len(gs.PossibleActions) != 0 {
+		t.Errorf("Expected the ended game to leave the tie-break, got tie-break %v", gs.TieBreakSideIDs)
+	}
+
+	// An escoba on the deal wins the sudden death too
+	rules := DefaultRules()
+	rules.TieRule = TIE_RULE_SUDDEN_DEATH
+	gs = New(WithRules(rules), WithCardOrder(deckWithInitialTable([]Card{{COPA, 1}, {COPA, 2}, {ESPADA, 5}, {BASTO, 7}})))
+	gs.Scores = map[int]int{0: 13, 1: 14}
+	scoreTiedSet(gs, false)
+	if !gs.IsWinner(1) || gs.EndReason != END_REASON_SUDDEN_DEATH || gs.Scores[1] != 16 || len(gs.TieBreakSideIDs) != 0 || len(gs.PossibleActions) != 0 {
+		t.Errorf("Expected the mano to win on a sudden death escoba on the deal, got winner %d reason %q with scores %v and tie-break %v", gs.WinnerPlayerID, gs.EndReason, gs.Scores, gs.TieBreakSideIDs)
+	}
+
+	// Without an escoba, the most points in the set win the sudden death
+	gs = newGame(TIE_RULE_SUDDEN_DEATH, map[int]int{0: 13, 1: 14})
+	scoreTiedSet(gs, false)
+	scoreTiedSet(gs, false)
+	if !gs.IsWinner(0) || gs.EndReason != END_REASON_SUDDEN_DEATH {
+		t.Errorf("Expected player 0 to win the sudden death set, got winner %d reason %q", gs.WinnerPlayerID, gs.EndReason)
+	}
+}
+
+func TestDeclareVictory(t *testing.T) {
+	rules := DefaultRules()
+	rules.VictoryClaims = true
+	gs := New(WithRules(rules))
+	gs.TurnPlayerID = 0
+	gs.Scores = map[int]int{0: 12, 1: 5}
+	gs.Escobas = map[int]int{0: 1, 1: 0}
+	gs.Piles = map[int][]Card{0: {{Suit: ORO, Number: 7}}, 1: {}}
+
+	// 12 points, 1 escoba and the 7 of oro: 14 isn't enough
+	if score := gs.ProvisionalScore(0); score != 14 {
+		t.Fatalf("Expected a provisional score of 14, got %d", score)
+	}
+	claim := newActionDeclareVictory()
+	if !slices.ContainsFunc(gs.CalculatePossibleActions(), func(a Action) bool { return a.GetName() == DECLARE_VICTORY }) {
+		t.Errorf("Expected claiming the win to be a possible action")
+	}
+	if err := gs.RunAction(claim); err != nil {
+		t.Fatalf("Error running action: %v", err)
+	}
+	if gs.IsEnded || gs.Scores[0] != 10 || gs.Penalties[0] != 2 || gs.TurnPlayerID != 0 {
+		t.Errorf("Expected a false claim to cost 2 points and keep the turn, got ended=%v scores=%v penalties=%v turn=%d", gs.IsEnded, gs.Scores, gs.Penalties, gs.TurnPlayerID)
+	}
+
+	// Only one claim per turn
+	if slices.ContainsFunc(gs.CalculatePossibleActions(), func(a Action) bool { return a.GetName() == DECLARE_VICTORY }) {
+		t.Errorf("Expected claiming the win not to be possible twice in a turn")
+	}
+	if err := gs.RunAction(claim); err == nil {
+		t.Errorf("Expected an error claiming the win twice in a turn")
+	}
+
+	// A false claim costs the full penalty, even at zero points
+	playRound := func() {
+		for i := 0; i < 2; i++ {
+			actions := gs.CalculatePossibleActions()
+			throw := actions[slices.IndexFunc(actions, func(a Action) bool { return a.GetName() == THROW_CARD })]
+			if err := gs.RunAction(throw); err != nil {
+				t.Fatalf("Error running action: %v", err)
+			}
+		}
+	}
+	playRound()
+	gs.Scores[0] = 0
+	if err := gs.RunAction(claim); err != nil {
+		t.Fatalf("Error running action: %v", err)
+	}
+	if gs.Scores[0] != -2 || gs.Penalties[0] != 4 {
+		t.Errorf("Expected a false claim at zero points to cost 2 points, got scores=%v penalties=%v", gs.Scores, gs.Penalties)
+	}
+
+	// Capturing more than half of the cards secures the most cards point
+	playRound()
+	gs.Scores[0] = 13
+	gs.Escobas = map[int]int{0: 1, 1: 0}
+	gs.Piles[0] = append([]Card{{Suit: ORO, Number: 7}}, SpanishCards()[10:31]...)
+	if score := gs.ProvisionalScore(0); score != 16 {
+		t.Fatalf("Expected a provisional score of 16, got %d", score)
+	}
+	if err := gs.RunAction(claim); err != nil {
+		t.Fatalf("Error running action: %v", err)
+	}
+	if !gs.IsWinner(0) || gs.EndReason != END_REASON_VICTORY_CLAIM || gs.Scores[0] != 16 || len(gs.PossibleActions) != 0 {
+		t.Errorf("Expected a rightful claim to win the game, got winner %d reason %q scores %v", gs.WinnerPlayerID, gs.EndReason, gs.Scores)
+	}
+
+	action, err := DeserializeAction(SerializeAction(claim))
+	if err != nil || action.GetName() != DECLARE_VICTORY {
+		t.Errorf("Expected to deserialize a victory claim, got %v (%v)", action, err)
+	}
+	if newActionDeclareVictory().IsPossible(*New()) {
+		t.Errorf("Expected claiming the win not to be possible by default")
+	}
+}
+
+func TestResignAndDrawActions(t *testing.T) {
+	// Player 1 resigns out of turn
+	gs := New()
+	if !slices.ContainsFunc(gs.CalculatePossibleActionsFor(1), func(a Action) bool { return a.GetName() == RESIGN }) {
+		t.Errorf("Expected player 1 to be able to resign out of turn")
+	}
+	if err := gs.RunAction(newActionResign(1)); err != nil {
+		t.Fatalf("Error running action: %v", err)
+	}
+	if !gs.IsWinner(0) || gs.EndReason != END_REASON_RESIGNATION || gs.ActionOwnerPlayerIDs[len(gs.ActionOwnerPlayerIDs)-1] != 1 {
+		t.Errorf("Expected player 0 to win by resignation of player 1, got winner %d reason %q", gs.WinnerPlayerID, gs.EndReason)
+	}
+	if len(gs.CalculatePossibleActionsFor(0)) != 0 {
+		t.Errorf("Expected no possible actions after the game ended")
+	}
+
+	// A declined draw offer, then an offer withdrawn by playing on, then an accepted one
+	gs = New()
+	if err := gs.RunAction(newActionOfferDraw(0)); err != nil {
+		t.Fatalf("Error running action: %v", err)
+	}
+	if gs.TurnPlayerID != 0 || newActionOfferDraw(1).IsPossible(*gs) || newActionAcceptDraw(0).IsPossible(*gs) {
+		t.Errorf("Expected the offer to keep the turn and to be answerable only by player 1")
+	}
+	if err := gs.RunAction(newActionDeclineDraw(1)); err != nil {
+		t.Fatalf("Error running action: %v", err)
+	}
+	if len(gs.DrawOfferSideIDs) != 0 {
+		t.Errorf("Expected a declined offer to be withdrawn, got %v", gs.DrawOfferSideIDs)
+	}
+
+	_ = gs.RunAction(newActionOfferDraw(0))
+	_ = gs.RunAction(gs.CalculatePossibleActions()[0])
+	if len(gs.DrawOfferSideIDs) != 1 {
+		t.Errorf("Expected the offer to stand after the offering player plays, got %v", gs.DrawOfferSideIDs)
+	}
+	_ = gs.RunAction(gs.CalculatePossibleActions()[0])
+	if len(gs.DrawOfferSideIDs) != 0 {
+		t.Errorf("Expected the offer to be withdrawn when the other player plays on, got %v", gs.DrawOfferSideIDs)
+	}
+
+	_ = gs.RunAction(newActionOfferDraw(1))
+	action, err := DeserializeAction(SerializeAction(newActionAcceptDraw(0)))
+	if err != nil {
+		t.Fatalf("Error deserializing action: %v", err)
+	}
+	if err := gs.RunAction(action); err != nil {
+		t.Fatalf("Error running action: %v", err)
+	}
+	if !gs.IsDraw() || gs.EndReason != END_REASON_DRAW_AGREED {
+		t.Errorf("Expected an agreed draw, got draw=%v reason %q", gs.IsDraw(), gs.EndReason)
+	}
+}
+
+func TestActionErrors(t *testing.T) {
+	gs := New()
+	gs.TurnPlayerID = 0
+	gs.Hands[0] = &Hand{Cards: []Card{{Suit: ORO, Number: 5}, {Suit: COPA, Number: 1}}}
+	gs.TableCards = []Card{{Suit: COPA, Number: 4}, {Suit: ESPADA, Number: 6}}
+
+	tests := []struct {
+		name     string
+		playerID int
+		action   Action
+		reason   string
+	}{
+		{"not your turn", 1, newActionThrowCard(Card{Suit: ORO, Number: 5}, nil), ACTION_ERROR_NOT_YOUR_TURN},
+		{"wrong player", 0, newActionResign(1), ACTION_ERROR_WRONG_PLAYER},
+		{"card not in hand", 0, newActionThrowCard(Card{Suit: BASTO, Number: 5}, nil), ACTION_ERROR_CARD_NOT_IN_HAND},
+		{"card not on table", 0, newActionThrowCard(Card{Suit: ORO, Number: 5}, []Card{{Suit: BASTO, Number: 4}, {Suit: ESPADA, Number: 6}}), ACTION_ERROR_CARD_NOT_ON_TABLE},
+		{"wrong sum", 0, newActionThrowCard(Card{Suit: ORO, Number: 5}, []Card{{Suit: COPA, Number: 4}}), ACTION_ERROR_WRONG_SUM},
+		{"capture is mandatory", 0, newActionThrowCard(Card{Suit: ORO, Number: 5}, nil), ACTION_ERROR_CAPTURE_IS_MANDATORY},
+		{"not allowed", 1, newActionAcceptDraw(1), ACTION_ERROR_NOT_ALLOWED},
+	}
+	for _, tt := range tests {
+		err := gs.CheckAction(tt.playerID, tt.action)
+		var actionErr *ActionError
+		if !errors.As(err, &actionErr) || actionErr.Reason != tt.reason || !errors.Is(err, ErrActionNotPossible) {
+			t.Errorf("%s: expected an action error with reason %q, got %v", tt.name, tt.reason, err)
+		}
+	}
+	if err := gs.CheckAction(0, newActionThrowCard(Card{Suit: ORO, Number: 5}, []Card{{Suit: COPA, Number: 4}, {Suit: ESPADA, Number: 6}})); err != nil {
+		t.Errorf("Expected a valid capture to pass the check, got %v", err)
+	}
+
+	// RunAction returns the same errors
+	err := gs.RunAction(newActionThrowCard(Card{Suit: ORO, Number: 5}, []Card{{Suit: COPA, Number: 4}}))
+	var actionErr *ActionError
+	if !errors.As(err, &actionErr) || actionErr.Reason != ACTION_ERROR_WRONG_SUM {
+		t.Errorf("Expected RunAction to return a wrong sum error, got %v", err)
+	}
+	_ = gs.RunAction(newActionResign(1))
+	if err := gs.RunAction(newActionOfferDraw(0)); !errors.Is(err, ErrGameIsEnded) {
+		t.Errorf("Expected a game is ended error, got %v", err)
+	}
+}
+
+func TestObserver(t *testing.T) {
+	var events []Event
+	gs := New(WithSeed(5), WithObserver(ObserverFunc(func(e Event) { events = append(events, e) })))
+
+	types := func(events []Event) []string {
+		var types []string
+		for _, e := range events {
+			types = append(types, e.Type)
+		}
+		return types
+	}
+	if got := types(events); len(got) < 4 || !slices.Equal(got[:4], []string{EVENT_SET_STARTED, EVENT_HAND_DEALT, EVENT_HAND_DEALT, EVENT_TABLE_DEALT}) {
+		t.Errorf("Expected the first deal's events, got %v", got)
+	}
+	if !slices.Equal(events[1].Cards, gs.Hands[0].Cards) || events[1].ViewFor(1).Cards != nil {
+		t.Errorf("Expected player 0's dealt hand, hidden from player 1, got %v", events[1].Cards)
+	}
+
+	for !gs.IsEnded {
+		events = nil
+		action := gs.CalculatePossibleActions()[0]
+		if err := gs.RunAction(action); err != nil {
+			t.Fatalf("Error running action: %v", err)
+		}
+		thrown := action.(ActionThrowCard)
+		expected := EVENT_CARD_THROWN
+		if thrown.IsCapture() {
+			expected = EVENT_CAPTURE
+		}
+		if len(events) < 2 || events[0].Type != EVENT_ACTION || events[1].Type != expected || *events[1].Card != thrown.Card {
+			t.Fatalf("Expected an action event followed by a %s event, got %v", expected, types(events))
+		}
+	}
+	got := types(events)
+	if !slices.Contains(got, EVENT_SET_SCORED) || got[len(got)-1] != EVENT_GAME_ENDED || events[len(events)-1].WinnerID != gs.WinnerPlayerID {
+		t.Errorf("Expected the set to be scored and the game to end, got %v", got)
+	}
+
+	events = nil
+	if err := gs.Undo(); err != nil {
+		t.Fatalf("Error undoing action: %v", err)
+	}
+	if len(events) != 0 {
+		t.Errorf("Expected undoing not to emit events, got %v", types(events))
+	}
+}
+
+// randomAction returns a random action to play: usually a throw by the player
+// whose turn it is, but seldom any action that some player may run, e.g.
+// resigning, claiming the win or offering, accepting or declining a draw.
+func randomAction(gs *GameState, r *rand.Rand) Action {
+	var actions []Action
+	if r.Intn(20) == 0 {
+		actions = gs.CalculatePossibleActionsFor(r.Intn(gs.rules().Players))
+	} else {
+		actions = slices.DeleteFunc(gs.CalculatePossibleActions(), func(a Action) bool { return a.GetName() != THROW_CARD })
+	}
+	if len(actions) == 0 {
+		return nil
+	}
+	return actions[r.Intn(len(actions))]
+}
+
+// playRandomGame plays random actions (see randomAction) until the game ends,
+// calling check after each of them.
+func playRandomGame(t *testing.T, gs *GameState, r *rand.Rand, check func(gs *GameState)) {
+	for actionCount := 0; !gs.IsEnded; actionCount++ {
+		if actionCount > 2000 {
+			t.Fatal("Game did not end within 2000 actions")
+		}
+		action := randomAction(gs, r)
+		if action == nil {
+			continue
+		}
+		if err := gs.RunAction(action); err != nil {
+			t.Fatalf("Error running %v: %v", action, err)
+		}
+		check(gs)
+	}
+}
+
+// validationRules are rule sets that exercise most of the engine
+func validationRules() []Rules {
+	var all []Rules
+	for i := 0; i < 6; i++ {
+		rules := DefaultRules()
+		rules.VictoryClaims = true
+		switch i {
+		case 1:
+			rules = scopaRules()
+		case 2:
+			rules.Players = 3
+			rules.OptionalCapture = true
+		case 3:
+			rules.Players = 4
+			rules.Teams = true
+			rules.TieRule = TIE_RULE_EXTRA_SETS
+		case 4:
+			rules.InitialEscoba = INITIAL_ESCOBA_DEALER
+			rules.InitialEscobaThirty = true
+			rules.LastCaptureNotEscoba = true
+			rules.TieRule = TIE_RULE_SUDDEN_DEATH
+		case 5:
+			rules.TargetScore = 21
+			rules.TieRule = TIE_RULE_DRAW
+		}
+		all = append(all, rules)
+	}
+	return all
+}
+
+func TestValidateRandomGames(t *testing.T) {
+	for i, rules := range validationRules() {
+		for seed := int64(0); seed < 5; seed++ {
+			gs := New(WithSeed(seed), WithRules(rules))
+			if err := gs.Validate(); err != nil {
+				t.Fatalf("rules %d, seed %d: invalid new game: %v", i, seed, err)
+			}
+			playRandomGame(t, gs, rand.New(rand.NewSource(seed)), func(gs *GameState) {
+				if err := gs.Validate(); err != nil {
+					t.Fatalf("rules %d, seed %d, after %s: %v", i, seed, gs.Actions[len(gs.Actions)-1], err)
+				}
+			})
+			if view := gs.ViewFor(0); view.Validate() != nil {
+				t.Errorf("rules %d, seed %d: invalid view: %v", i, seed, view.Validate())
+			}
+		}
+	}
+}
+
+func TestValidateCatchesViolations(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(gs *GameState)
+	}{
+		{"duplicated card", func(gs *GameState) { gs.TableCards = append(gs.TableCards, gs.Hands[0].Cards[0]) }},
+		{"lost card", func(gs *GameState) { gs.Hands[1].Cards = gs.Hands[1].Cards[1:] }},
+		{"unknown card", func(gs *GameState) { gs.Hands[0].Cards[0] = Card{Suit: ORO, Number: 8} }},
+		{"turn player not seated", func(gs *GameState) { gs.TurnPlayerID = 2 }},
+		{"wrong deck count", func(gs *GameState) { gs.DeckCount++ }},
+		{"extra escoba", func(gs *GameState) { gs.Escobas[1]++ }},
+		{"wrong score", func(gs *GameState) { gs.Scores[0] += 3 }},
+		{"winner of an unended game", func(gs *GameState) { gs.WinnerPlayerID = 0 }},
+	}
+	for _, tt := range tests {
+		gs := New(WithSeed(3))
+		_ = gs.RunAction(gs.CalculatePossibleActions()[0])
+		if err := gs.Validate(); err != nil {
+			t.Fatalf("%s: expected a valid game before corrupting it, got %v", tt.name, err)
+		}
+		tt.corrupt(gs)
+		if err := gs.Validate(); !errors.Is(err, ErrInvariantViolated) {
+			t.Errorf("%s: expected an invariant violation, got %v", tt.name, err)
+		}
+	}
+}
+
+func FuzzValidate(f *testing.F) {
+	for seed := int64(0); seed < 4; seed++ {
+		f.Add(seed, uint8(seed))
+	}
+	f.Fuzz(func(t *testing.T, seed int64, rulesIndex uint8) {
+		rules := validationRules()
+		gs := New(WithSeed(seed), WithRules(rules[int(rulesIndex)%len(rules)]))
+		playRandomGame(t, gs, rand.New(rand.NewSource(seed)), func(gs *GameState) {
+			if err := gs.Validate(); err != nil {
+				t.Fatalf("After %s: %v", gs.Actions[len(gs.Actions)-1], err)
+			}
+		})
+	})
+}
+
+func TestCanonicalOrder(t *testing.T) {
+	if CompareCards(Card{Suit: ORO, Number: 12}, Card{Suit: COPA, Number: 1}) >= 0 || (Card{Suit: BASTO, Number: 12}).Index() != 39 || (Card{Suit: ORO, Number: 8}).Index() != -1 {
+		t.Errorf("Expected cards to be ordered by suit and then by number")
+	}
+
+	// Hand cards, combinations and their cards are listed in canonical order
+	gs := New(WithSeed(11))
+	gs.TableCards = []Card{{Suit: BASTO, Number: 2}, {Suit: ORO, Number: 5}, {Suit: COPA, Number: 3}, {Suit: ORO, Number: 1}}
+	gs.Hands[0] = &Hand{Cards: []Card{{Suit: ESPADA, Number: 12}, {Suit: ORO, Number: 4}}}
+	gs.TurnPlayerID = 0
+	var got []string
+	for _, action := range gs.CalculatePossibleActions() {
+		got = append(got, action.String())
+	}
+	expected := []string{
+		"throw 4 de oro and capture [1 de oro, 5 de oro, 3 de copa, 2 de basto]",
+		"throw 12 de espada and capture [5 de oro]",
+		"throw 12 de espada and capture [3 de copa, 2 de basto]",
+	}
+	if !slices.Equal(got, expected) {
+		t.Errorf("Expected actions %v, got %v", expected, got)
+	}
+
+	// The table stays in canonical order as cards are captured and thrown
+	gs.TableCards = sortedCards(gs.TableCards)
+	_ = gs.RunAction(newActionThrowCard(Card{Suit: ESPADA, Number: 12}, []Card{{Suit: COPA, Number: 3}, {Suit: BASTO, Number: 2}}))
+	gs.Hands[1] = &Hand{Cards: []Card{{Suit: COPA, Number: 1}}}
+	_ = gs.RunAction(newActionThrowCard(Card{Suit: COPA, Number: 1}, nil))
+	if expected := []Card{{Suit: ORO, Number: 1}, {Suit: ORO, Number: 5}, {Suit: COPA, Number: 1}}; !slices.Equal(gs.TableCards, expected) {
+		t.Errorf("Expected table %v, got %v", expected, gs.TableCards)
+	}
+
+	// Games with the same seed and actions stay identical, down to their hashes
+	gs1, gs2 := New(WithSeed(12)), New(WithSeed(12))
+	for !gs1.IsEnded {
+		for _, g := range []*GameState{gs1, gs2} {
+			for _, playerID := range g.PlayerIDs() {
+				if !slices.IsSortedFunc(g.Hands[playerID].Cards, CompareCards) {
+					t.Fatalf("Expected player %d's hand in canonical order, got %v", playerID, g.Hands[playerID].Cards)
+				}
+			}
+			if !slices.IsSortedFunc(g.TableCards, CompareCards) {
+				t.Fatalf("Expected the table in canonical order, got %v", g.TableCards)
+			}
+		}
+		if !reflect.DeepEqual(gs1.PossibleActions, gs2.PossibleActions) || gs1.Hash() != gs2.Hash() {
+			t.Fatalf("Expected identical games to have the same possible actions and hash")
+		}
+		actions := gs1.CalculatePossibleActions()
+		action := actions[len(actions)/2]
+		_ = gs1.RunAction(action)
+		_ = gs2.RunAction(action)
+	}
+}
+
+func TestHash(t *testing.T) {
+	gs := New(WithSeed(13))
+	hash := gs.Hash()
+	restored, err := Restore(gs.Snapshot())
+	if err != nil {
+		t.Fatalf("Error restoring snapshot: %v", err)
+	}
+	if restored.Hash() != hash {
+		t.Errorf("Expected a restored game to have the same hash")
+	}
+
+	// Piles are hashed as sets, and history is left out
+	gs.Piles[0] = []Card{{Suit: ORO, Number: 1}, {Suit: COPA, Number: 1}}
+	restored.Piles[0] = []Card{{Suit: COPA, Number: 1}, {Suit: ORO, Number: 1}}
+	restored.Actions = append(restored.Actions, SerializeAction(newActionOfferDraw(0)))
+	if gs.Hash() != restored.Hash() {
+		t.Errorf("Expected games in the same position to have the same hash")
+	}
+
+	for name, change := range map[string]func(g *GameState){
+		"turn":  func(g *GameState) { g.TurnPlayerID = 1 },
+		"table": func(g *GameState) { g.TableCards = g.TableCards[1:] },
+		"deck":  func(g *GameState) { g.deck.cards[0], g.deck.cards[1] = g.deck.cards[1], g.deck.cards[0] },
+		"score": func(g *GameState) { g.Scores[1]++ },
+	} {
+		changed, _ := Restore(gs.Snapshot())
+		change(changed)
+		if changed.Hash() == gs.Hash() {
+			t.Errorf("Expected a change of %s to change the hash", name)
+		}
+	}
+}
+
+// referencePossibleActions lists the turn's actions with the slice-based
+// combination search, as the engine did before moves were generated from bitsets
+func referencePossibleActions(g GameState) []Action {
+	var actions []Action
+	hand := sortedCards(g.Hands[g.TurnPlayerID].Cards)
+	for _, card := range hand {
+		for _, combination := range g.findAllValidCombinations(card, g.TableCards) {
+			actions = append(actions, newActionThrowCard(card, combination))
+		}
+	}
+	if len(actions) == 0 || g.rules().OptionalCapture {
+		for _, card := range hand {
+			actions = append(actions, newActionThrowCard(card, []Card{}))
+		}
+	}
+	if claim := newActionDeclareVictory(); claim.IsPossible(g) {
+		actions = append(actions, claim)
+	}
+	return actions
+}
+
+func TestMoveGenerationMatchesReference(t *testing.T) {
+	for i, rules := range validationRules() {
+		gs := New(WithSeed(int64(i)), WithRules(rules))
+		playRandomGame(t, gs, rand.New(rand.NewSource(int64(i))), func(gs *GameState) {
+			if gs.IsEnded {
+				return
+			}
+			if got, expected := gs.CalculatePossibleActions(), referencePossibleActions(*gs); !reflect.DeepEqual(got, expected) {
+				t.Fatalf("rules %d: expected actions %v, got %v", i, expected, got)
+			}
+			for _, playerID := range gs.PlayerIDs() {
+				expected := []json.RawMessage{}
+				for _, action := range gs.CalculatePossibleActionsFor(playerID) {
+					bs, _ := json.Marshal(action)
+					expected = append(expected, bs)
+				}
+				if got := gs.possibleActionsJSON(playerID); !reflect.DeepEqual(got, expected) {
+					t.Fatalf("rules %d: expected serialized actions for player %d %s, got %s", i, playerID, expected, got)
+				}
+			}
+		})
+	}
+
+	// Hands and tables that aren't sets of Spanish cards are worked out card by card
+	for _, cards := range [][]Card{
+		{{Suit: ORO, Number: 5}, {Suit: ORO, Number: 5}, {Suit: COPA, Number: 12}, {Suit: COPA, Number: 12}},
+		{{Suit: "comodín", Number: 5}, {Suit: ORO, Number: 4}, {Suit: COPA, Number: 6}, {Suit: "comodín", Number: 12}},
+	} {
+		gs := New()
+		gs.Hands[gs.TurnPlayerID] = &Hand{Cards: slices.Clone(cards[:2])}
+		gs.TableCards = slices.Clone(cards[2:])
+		if got, expected := gs.CalculatePossibleActions(), referencePossibleActions(*gs); len(expected) == 0 || !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected actions %v for hand %v and table %v, got %v", expected, cards[:2], cards[2:], got)
+		}
+		if got, expected := gs.possibleActionsJSON(gs.TurnPlayerID), _serializeActions(gs.CalculatePossibleActionsFor(gs.TurnPlayerID)); !reflect.DeepEqual(got, expected) {
+			t.Errorf("Expected serialized actions %s, got %s", expected, got)
+		}
+		if err := gs.RunAction(newActionThrowCard(cards[0], []Card{})); err == nil {
+			t.Errorf("Expected a throw to the table to be refused when %v can capture from %v", cards[0], cards[2:])
+		}
+	}
+
+	// Serializing without reflection gives the same JSON, down to nil captures
+	for _, action := range []Action{newActionThrowCard(Card{Suit: ESPADA, Number: 12}, nil), newActionThrowCard(Card{Suit: "?", Number: 0}, []Card{{Suit: ORO, Number: 1}}), newActionDeclareVictory(), newActionDeclineDraw(3)} {
+		if expected, _ := json.Marshal(action); string(SerializeAction(action)) != string(expected) {
+			t.Errorf("Expected %s, got %s", expected, SerializeAction(action))
+		}
+	}
+}
+
+func TestCloneAndApply(t *testing.T) {
+	for i, rules := range validationRules() {
+		gs := New(WithSeed(int64(i)), WithRules(rules))
+		applied := *gs.Clone()
+		r := rand.New(rand.NewSource(int64(i)))
+		for !gs.IsEnded {
+			// Play a few actions on a clone, which must leave the game untouched
+			hash, actionCount := gs.Hash(), len(gs.Actions)
+			clone := gs.Clone()
+			for j := 0; j < 5 && !clone.IsEnded; j++ {
+				if action := randomAction(clone, r); action != nil {
+					_ = clone.RunAction(action)
+				}
+			}
+			if gs.Hash() != hash || len(gs.Actions) != actionCount {
+				t.Fatalf("rules %d: expected the game to be untouched by its clone", i)
+			}
+
+			// Apply leaves the game untouched too, and returns what RunAction does to it
+			action := randomAction(gs, r)
+			if action == nil {
+				continue
+			}
+			next, err := applied.Apply(action)
+			if err != nil {
+				t.Fatalf("rules %d: error applying %v: %v", i, action, err)
+			}
+			if applied.Hash() != hash {
+				t.Fatalf("rules %d: expected the game to be untouched by Apply", i)
+			}
+			applied = next
+			if err := gs.RunAction(action); err != nil {
+				t.Fatalf("rules %d: error running %v: %v", i, action, err)
+			}
+			if applied.Hash() != gs.Hash() {
+				t.Fatalf("rules %d: expected Apply to return the game after running %v", i, action)
+			}
+		}
+		if !reflect.DeepEqual(applied.Snapshot(), gs.Snapshot()) {
+			t.Errorf("rules %d: expected a game played with Apply to end like one played with RunAction", i)
+		}
+		if err := applied.Validate(); err != nil {
+			t.Errorf("rules %d: invalid game played with Apply: %v", i, err)
+		}
+	}
+
+	gs := New()
+	if _, err := gs.Apply(newActionAcceptDraw(1)); !errors.Is(err, ErrActionNotPossible) {
+		t.Errorf("Expected Apply to fail on an impossible action, got %v", err)
+	}
+}
+
+func TestDeterminize(t *testing.T) {
+	for i, rules := range validationRules() {
+		gs := New(WithSeed(int64(i)), WithRules(rules))
+		r := rand.New(rand.NewSource(int64(i)))
+		for actionCount := 0; !gs.IsEnded && actionCount < 30; actionCount++ {
+			playerID := r.Intn(rules.Players)
+			view := gs.ViewFor(playerID)
+			unseen := view.UnseenCards(playerID)
+			if !slices.Equal(unseen, gs.UnseenCards(playerID)) || !slices.IsSortedFunc(unseen, CompareCards) {
+				t.Fatalf("rules %d: expected the same unseen cards in canonical order from the game and the view", i)
+			}
+
+			sample, err := view.Determinize(playerID, r)
+			if err != nil {
+				t.Fatalf("rules %d: error determinizing: %v", i, err)
+			}
+			if err := sample.Validate(); err != nil {
+				t.Fatalf("rules %d: invalid sample: %v", i, err)
+			}
+			if !slices.Equal(sample.Hands[playerID].Cards, gs.Hands[playerID].Cards) || !slices.Equal(sample.TableCards, gs.TableCards) || !reflect.DeepEqual(sample.Piles, gs.Piles) {
+				t.Fatalf("rules %d: expected the sample to keep what player %d has seen", i, playerID)
+			}
+			var sampled []Card
+			for _, otherID := range gs.PlayerIDs() {
+				if otherID != playerID {
+					if sample.Hands[otherID].Len() != gs.Hands[otherID].Len() {
+						t.Fatalf("rules %d: expected player %d to hold %d cards, got %d", i, otherID, gs.Hands[otherID].Len(), sample.Hands[otherID].Len())
+					}
+					sampled = append(sampled, sample.Hands[otherID].Cards...)
+				}
+			}
+			sampled = append(sampled, sample.deck.cards...)
+			if !slices.Equal(sortedCards(sampled), unseen) || sample.DeckCount != gs.DeckCount {
+				t.Fatalf("rules %d: expected the unseen cards to be dealt to the other hands and the deck", i)
+			}
+
+			// The sample can be played on like the real game
+			if action := randomAction(sample, r); action != nil {
+				if err := sample.RunAction(action); err != nil {
+					t.Fatalf("rules %d: error running %v on the sample: %v", i, action, err)
+				}
+			}
+
+			if action := randomAction(gs, r); action != nil {
+				_ = gs.RunAction(action)
+			}
+		}
+	}
+
+	// Samples differ in what the player can't see
+	gs := New(WithSeed(1))
+	r := rand.New(rand.NewSource(1))
+	hands := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		sample, _ := gs.Determinize(0, r)
+		hands[sample.Hands[1].String()] = true
+	}
+	if len(hands) < 2 {
+		t.Errorf("Expected samples to deal different hands to player 1")
+	}
+
+	// Hidden cards must add up
+	view := gs.ViewFor(0)
+	view.DeckCount++
+	if _, err := view.Determinize(0, r); err == nil {
+		t.Errorf("Expected an error when the hidden cards don't add up")
+	}
+}
+
+// benchmarkStates returns the states of a few random games, to benchmark move generation on
+func benchmarkStates() []*GameState {
+	var states []*GameState
+	for seed := int64(0); seed < 4; seed++ {
+		gs := New(WithSeed(seed))
+		r := rand.New(rand.NewSource(seed))
+		for !gs.IsEnded {
+			restored, _ := Restore(gs.Snapshot())
+			states = append(states, restored)
+			actions := gs.CalculatePossibleActions()
+			_ = gs.RunAction(actions[r.Intn(len(actions))])
+		}
+	}
+	return states
+}
+
+func BenchmarkCalculatePossibleActions(b *testing.B) {
+	states := benchmarkStates()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = states[i%len(states)].CalculatePossibleActions()
+	}
+}
+
+func BenchmarkSelfPlay(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		gs := New(WithSeed(int64(i)))
+		r := rand.New(rand.NewSource(int64(i)))
+		for !gs.IsEnded {
+			actions := gs.CalculatePossibleActions()
+			_ = gs.RunAction(actions[r.Intn(len(actions))])
+		}
+	}
+}
+
+func BenchmarkReferencePossibleActions(b *testing.B) {
+	states := benchmarkStates()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = referencePossibleActions(*states[i%len(states)])
+	}
+}
+
+func BenchmarkAppendMoves(b *testing.B) {
+	states := benchmarkStates()
+	moves := make([]move, 0, 64)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		moves = states[i%len(states)].appendMoves(moves[:0])
+	}
+}
+
+func BenchmarkClone(b *testing.B) {
+	states := benchmarkStates()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = states[i%len(states)].Clone()
+	}
+}
+
+func BenchmarkApply(b *testing.B) {
+	states := benchmarkStates()
+	actions := make([]Action, len(states))
+	for i, state := range states {
+		actions[i] = state.CalculatePossibleActions()[0]
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _ = states[i%len(states)].Apply(actions[i%len(states)])
+	}
+}
+
+func TestISMCTSBotPlaysLegalActions(t *testing.T) {
+	bot := NewISMCTSBot(ISMCTSConfig{Iterations: 50, Workers: 2, Exploration: 0.7, Seed: 1})
+	for i, rules := range validationRules() {
+		gs := New(WithSeed(int64(i)), WithRules(rules))
+		for actionCount := 0; !gs.IsEnded && actionCount < 40; actionCount++ {
+			action := bot.ChooseAction(*gs)
+			if action == nil {
+				t.Fatalf("rules %d: expected an action", i)
+			}
+			if err := gs.RunAction(action); err != nil {
+				t.Fatalf("rules %d: error running %v: %v", i, action, err)
+			}
+		}
+	}
+
+	// Games set up by hand can't be sampled, so the bot falls back to SimpleBot
+	gs := New()
+	gs.Hands[gs.TurnPlayerID].Cards = gs.Hands[gs.TurnPlayerID].Cards[:1]
+	if err := gs.RunAction(bot.ChooseAction(*gs)); err != nil {
+		t.Errorf("Expected a possible action on a game set up by hand, got %v", err)
+	}
+}
+
+func TestISMCTSBotBeatsSimpleBot(t *testing.T) {
+	if testing.Short() {
+		t.Skip("plays full games")
+	}
+	ismcts := NewISMCTSBot(ISMCTSConfig{Iterations: 300, Exploration: 0.7, HeuristicRollouts: true, Seed: 1})
+	simple := NewBot()
+	points := map[string]int{}
+	for game := 0; game < 6; game++ {
+		// The ISMCTS bot takes turns sitting in each seat
+		gs := New(WithSeed(int64(game)))
+		bots := map[int]Bot{game % 2: ismcts, 1 - game%2: simple}
+		for actionCount := 0; !gs.IsEnded; actionCount++ {
+			if actionCount > 2000 {
+				t.Fatal("Game did not end within 2000 actions")
+			}
+			if err := gs.RunAction(bots[gs.TurnPlayerID].ChooseAction(*gs)); err != nil {
+				t.Fatalf("Error running action: %v", err)
+			}
+		}
+		points["ismcts"] += gs.Scores[game%2]
+		points["simple"] += gs.Scores[1-game%2]
+	}
+	if points["ismcts"] <= points["simple"] {
+		t.Errorf("Expected the ISMCTS bot to score more than SimpleBot, got %v", points)
+	}
+}
+
+func TestNewISMCTSBotNeedsABudget(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Errorf("Expected a panic without iterations nor a time budget")
+		}
+	}()
+	NewISMCTSBot(ISMCTSConfig{})
+}
+
+func BenchmarkISMCTSBot(b *testing.B) {
+	states := benchmarkStates()
+	bot := NewISMCTSBot(ISMCTSConfig{Iterations: 100, Workers: 1, Exploration: 0.7, HeuristicRollouts: true, Seed: 1})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_ = bot.ChooseAction(*states[i%len(states)])
+	}
+}
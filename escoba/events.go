@@ -0,0 +1,113 @@
+package escoba
+
+import "encoding/json"
+
+const (
+	// EVENT_ACTION is emitted when an action is run, before its effects.
+	EVENT_ACTION = "action"
+
+	// EVENT_SET_STARTED is emitted when a set starts, before its first deal.
+	EVENT_SET_STARTED = "set_started"
+
+	// EVENT_HAND_DEALT is emitted for each hand dealt to a player.
+	EVENT_HAND_DEALT = "hand_dealt"
+
+	// EVENT_TABLE_DEALT is emitted when the initial table cards of a set are dealt.
+	EVENT_TABLE_DEALT = "table_dealt"
+
+	// EVENT_INITIAL_ESCOBA is emitted when a player sweeps the initial table cards.
+	EVENT_INITIAL_ESCOBA = "initial_escoba"
+
+	// EVENT_CARD_THROWN is emitted when a card is thrown to the table without capturing.
+	EVENT_CARD_THROWN = "card_thrown"
+
+	// EVENT_CAPTURE is emitted when a thrown card captures table cards.
+	EVENT_CAPTURE = "capture"
+
+	// EVENT_ESCOBA is emitted when a capture clears the table and counts as an escoba.
+	EVENT_ESCOBA = "escoba"
+
+	// EVENT_LAST_CAPTURER_SWEEP is emitted when the cards left on the table at
+	// the end of a set go to the last player who captured.
+	EVENT_LAST_CAPTURER_SWEEP = "last_capturer_sweep"
+
+	// EVENT_SET_SCORED is emitted when a set is scored.
+	EVENT_SET_SCORED = "set_scored"
+
+	// EVENT_GAME_ENDED is emitted when the game ends.
+	EVENT_GAME_ENDED = "game_ended"
+)
+
+// Event is something that happened in a game. Type is one of the EVENT_*
+// constants, and decides which of the other fields are set.
+type Event struct {
+	Type string `json:"type"`
+
+	// PlayerID is the player the event is about, or -1.
+	PlayerID int `json:"playerID"`
+
+	// SetNumber and RoundNumber tell when the event happened.
+	SetNumber   int `json:"setNumber"`
+	RoundNumber int `json:"roundNumber"`
+
+	// Card is the thrown card (EVENT_CARD_THROWN and EVENT_CAPTURE).
+	Card *Card `json:"card,omitempty"`
+
+	// Cards are the dealt cards (EVENT_HAND_DEALT and EVENT_TABLE_DEALT), or the
+	// table cards taken (EVENT_INITIAL_ESCOBA, EVENT_CAPTURE and EVENT_LAST_CAPTURER_SWEEP).
+	Cards []Card `json:"cards,omitempty"`
+
+	// Action is the serialized action (EVENT_ACTION).
+	Action json.RawMessage `json:"action,omitempty"`
+
+	// SetResult is the result of the set (EVENT_SET_SCORED).
+	SetResult *SetResult `json:"setResult,omitempty"`
+
+	// WinnerID is the winning player (or team, in team mode), or -1 for a draw,
+	// and EndReason is how the game ended (EVENT_GAME_ENDED).
+	WinnerID  int    `json:"winnerID"`
+	EndReason string `json:"endReason,omitempty"`
+}
+
+// ViewFor returns the event as seen by playerID: the cards dealt to other
+// players are hidden.
+func (e Event) ViewFor(playerID int) Event {
+	if e.Type == EVENT_HAND_DEALT && e.PlayerID != playerID {
+		e.Cards = nil
+	}
+	return e
+}
+
+// Observer is notified of the events of a game, in the order they happen.
+type Observer interface {
+	OnEvent(event Event)
+}
+
+// ObserverFunc lets an ordinary function be used as an Observer.
+type ObserverFunc func(event Event)
+
+func (f ObserverFunc) OnEvent(event Event) {
+	f(event)
+}
+
+// WithObserver notifies observer of the events of the game, starting with the
+// first deal. Undoing actions doesn't notify it of the replayed actions.
+func WithObserver(observer Observer) func(*GameState) {
+	return func(g *GameState) {
+		g.observers = append(g.observers, observer)
+	}
+}
+
+// emit notifies the game's observers of an event about playerID
+func (g *GameState) emit(eventType string, playerID int, fill func(*Event)) {
+	if len(g.observers) == 0 {
+		return
+	}
+	event := Event{Type: eventType, PlayerID: playerID, SetNumber: g.SetNumber, RoundNumber: g.RoundNumber, WinnerID: -1}
+	if fill != nil {
+		fill(&event)
+	}
+	for _, observer := range g.observers {
+		observer.OnEvent(event)
+	}
+}
@@ -0,0 +1,99 @@
+package escoba
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+)
+
+// Hash returns a deterministic hash of the game's position: the rules, the set,
+// round and turn, the cards in the deck, hands, table and piles, escobas,
+// scores, penalties, and how the game stands (tie-breaks, draw offers and its end).
+//
+// The history that led to the position (e.g. Actions and Seed) is left out, so
+// two games in the same position have the same hash, whatever their history.
+// Piles are hashed as sets, since the order of captured cards doesn't matter.
+// Views (see ViewFor) only hash the cards and card counts they can see.
+func (g GameState) Hash() uint64 {
+	h := stateHasher{buf: make([]byte, 0, 512)}
+
+	rules := g.rules()
+	h.string(rules.Variant)
+	h.ints(rules.Players, rules.TargetScore, rules.HandSize, rules.InitialTableSize, rules.CaptureSum, rules.FalseClaimPenalty)
+	h.string(rules.InitialEscoba)
+	h.string(rules.TieRule)
+	h.bools(rules.Teams, rules.InitialEscobaThirty, rules.OptionalCapture, rules.LastCaptureNotEscoba, rules.VictoryClaims)
+
+	h.ints(g.SetNumber, g.RoundNumber, g.RoundTurnPlayerID, g.TurnPlayerID, g.LastCapturerPlayerID, g.DeckCount)
+	if g.deck != nil {
+		h.cards(g.deck.cards)
+	}
+	for _, playerID := range sortedKeys(g.Hands) {
+		h.ints(playerID)
+		if hand := g.Hands[playerID]; hand != nil {
+			h.ints(hand.HiddenCount)
+			h.cards(sortedCards(hand.Cards))
+		}
+	}
+	h.cards(sortedCards(g.TableCards))
+	for _, playerID := range sortedKeys(g.Piles) {
+		h.ints(playerID)
+		h.cards(sortedCards(g.Piles[playerID]))
+	}
+	h.intMap(g.Escobas)
+	h.intMap(g.Scores)
+	h.intMap(g.Penalties)
+
+	h.ints(g.TieBreakSideIDs...)
+	h.ints(g.DrawOfferSideIDs...)
+	h.bools(g.IsEnded)
+	h.ints(g.WinnerPlayerID, g.WinnerTeamID)
+	h.string(g.EndReason)
+
+	f := fnv.New64a()
+	_, _ = f.Write(h.buf)
+	return f.Sum64()
+}
+
+// stateHasher serializes the parts of a GameState that Hash covers. Each list is
+// prefixed with its length, so that different states can't serialize the same way.
+type stateHasher struct {
+	buf []byte
+}
+
+func (h *stateHasher) ints(values ...int) {
+	h.buf = binary.AppendVarint(h.buf, int64(len(values)))
+	for _, value := range values {
+		h.buf = binary.AppendVarint(h.buf, int64(value))
+	}
+}
+
+func (h *stateHasher) bools(values ...bool) {
+	for _, value := range values {
+		if value {
+			h.buf = append(h.buf, 1)
+		} else {
+			h.buf = append(h.buf, 0)
+		}
+	}
+}
+
+func (h *stateHasher) string(s string) {
+	h.buf = binary.AppendVarint(h.buf, int64(len(s)))
+	h.buf = append(h.buf, s...)
+}
+
+func (h *stateHasher) cards(cards []Card) {
+	h.buf = binary.AppendVarint(h.buf, int64(len(cards)))
+	for _, card := range cards {
+		h.string(card.Suit)
+		h.buf = binary.AppendVarint(h.buf, int64(card.Number))
+	}
+}
+
+func (h *stateHasher) intMap(m map[int]int) {
+	keys := sortedKeys(m)
+	h.buf = binary.AppendVarint(h.buf, int64(len(keys)))
+	for _, key := range keys {
+		h.ints(key, m[key])
+	}
+}
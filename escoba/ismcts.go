@@ -0,0 +1,323 @@
+package escoba
+
+import (
+	"math"
+	"math/rand"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// ISMCTSConfig configures an ISMCTSBot. Use DefaultISMCTSConfig as a starting point.
+type ISMCTSConfig struct {
+	// Iterations is the number of iterations to run per move, shared among the
+	// workers. Zero means no limit, as long as there's a TimeBudget.
+	Iterations int
+
+	// TimeBudget is the time to think per move. Zero means no limit, as long as
+	// there are Iterations.
+	TimeBudget time.Duration
+
+	// Workers is the number of goroutines that search in parallel, each on its
+	// own tree; their results are merged at the root. Zero means GOMAXPROCS.
+	Workers int
+
+	// Exploration is the UCT exploration constant.
+	Exploration float64
+
+	// HeuristicRollouts makes rollouts prefer escobas and captures, instead of
+	// playing uniformly random moves.
+	HeuristicRollouts bool
+
+	// Seed seeds the bot's random choices. Zero means a random seed.
+	Seed int64
+}
+
+// DefaultISMCTSConfig returns a configuration that plays strongly in a fraction
+// of a second on a desktop machine.
+func DefaultISMCTSConfig() ISMCTSConfig {
+	return ISMCTSConfig{
+		Iterations:        2000,
+		Exploration:       0.7,
+		HeuristicRollouts: true,
+	}
+}
+
+// ISMCTSBot chooses actions with Information Set Monte Carlo Tree Search: every
+// iteration samples a game consistent with what the bot's player knows (see
+// GameState.Determinize), walks down a tree of moves shared by all samples with
+// UCT selection, plays the rest of the set out, and scores the result.
+//
+// It never looks at the cards its player can't see, so it plays fairly.
+type ISMCTSBot struct {
+	config ISMCTSConfig
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewISMCTSBot creates an ISMCTS bot with the given configuration.
+//
+// It panics if neither Iterations nor TimeBudget are positive.
+func NewISMCTSBot(config ISMCTSConfig) Bot {
+	if config.Iterations <= 0 && config.TimeBudget <= 0 {
+		panic("escoba: an ISMCTS bot needs positive Iterations or TimeBudget")
+	}
+	if config.Workers <= 0 {
+		config.Workers = runtime.GOMAXPROCS(0)
+	}
+	seed := config.Seed
+	if seed == 0 {
+		seed = rand.Int63()
+	}
+	return &ISMCTSBot{config: config, rand: rand.New(rand.NewSource(seed))}
+}
+
+// ismctsNode is a move in the search tree, shared by every determinization in
+// which it's legal.
+type ismctsNode struct {
+	parent   *ismctsNode
+	children []*ismctsNode
+
+	// move is the move that leads to the node, and playerID the player who made it
+	move     move
+	playerID int
+
+	// visits is the number of iterations that went through the node, and
+	// availability the number of iterations in which it could have been chosen.
+	visits       int
+	availability int
+
+	// reward is the sum of the rewards of the iterations that went through the
+	// node, for playerID.
+	reward float64
+}
+
+// ChooseAction searches for the best action of the player whose turn it is.
+// It claims the win whenever the claim is right, and never claims it falsely.
+//
+// If the game isn't consistent with a full deck (e.g. it was set up by hand),
+// it can't be sampled, and the bot plays like SimpleBot.
+func (b *ISMCTSBot) ChooseAction(gameState GameState) Action {
+	actions := gameState.CalculatePossibleActions()
+	if len(actions) == 0 {
+		return nil
+	}
+	throws := make([]Action, 0, len(actions))
+	for _, action := range actions {
+		if action.GetName() == DECLARE_VICTORY && gameState.ProvisionalScore(gameState.TurnPlayerID) >= gameState.rules().TargetScore {
+			return action
+		}
+		if action.GetName() == THROW_CARD {
+			throws = append(throws, action)
+		}
+	}
+	if len(throws) <= 1 {
+		return NewBot().ChooseAction(gameState)
+	}
+
+	// Each worker searches on its own tree, and the root visits are added up
+	visits := map[move]int{}
+	sampled := true
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	deadline := time.Time{}
+	if b.config.TimeBudget > 0 {
+		deadline = time.Now().Add(b.config.TimeBudget)
+	}
+	for worker := 0; worker < b.config.Workers; worker++ {
+		iterations := -1
+		if b.config.Iterations > 0 {
+			iterations = b.config.Iterations / b.config.Workers
+			if worker < b.config.Iterations%b.config.Workers {
+				iterations++
+			}
+		}
+		b.mu.Lock()
+		r := rand.New(rand.NewSource(b.rand.Int63()))
+		b.mu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			root, ok := b.search(gameState, r, iterations, deadline)
+			mu.Lock()
+			defer mu.Unlock()
+			sampled = sampled && ok
+			for _, child := range root.children {
+				visits[child.move] += child.visits
+			}
+		}()
+	}
+	wg.Wait()
+	if !sampled {
+		return NewBot().ChooseAction(gameState)
+	}
+
+	best, bestVisits := throws[0], -1
+	for _, action := range throws {
+		throw := action.(ActionThrowCard)
+		m := move{card: throw.Card.Index(), captured: cardSetOf(throw.CapturedTableCards)}
+		if visits[m] > bestVisits {
+			best, bestVisits = action, visits[m]
+		}
+	}
+	return best
+}
+
+// search runs iterations (or, if -1, as many as fit before the deadline) on a
+// new tree, and returns its root. It returns false if the game can't be sampled
+// (see GameState.Determinize).
+func (b *ISMCTSBot) search(gameState GameState, r *rand.Rand, iterations int, deadline time.Time) (*ismctsNode, bool) {
+	root := &ismctsNode{playerID: -1}
+	playerID := gameState.TurnPlayerID
+	moves := make([]move, 0, 64)
+	for i := 0; i != iterations; i++ {
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			break
+		}
+		sample, err := gameState.Determinize(playerID, r)
+		if err != nil {
+			return root, false
+		}
+
+		// Select down the tree while every legal move has been tried, and expand one that hasn't
+		node := root
+		for !isSearchOver(sample, &gameState) {
+			moves = sample.appendMoves(moves[:0])
+			child, expanded := b.selectChild(node, moves, sample.TurnPlayerID, r)
+			runMove(sample, child.move)
+			node = child
+			if expanded {
+				break
+			}
+		}
+
+		// Play the set out, and score it
+		for !isSearchOver(sample, &gameState) {
+			moves = sample.appendMoves(moves[:0])
+			runMove(sample, b.rolloutMove(sample, moves, r))
+		}
+		for ; node != nil; node = node.parent {
+			node.visits++
+			if node.playerID != -1 {
+				node.reward += searchReward(sample, &gameState, node.playerID)
+			}
+		}
+	}
+	return root, true
+}
+
+// selectChild returns the child of node for one of the legal moves: a new one
+// if some moves haven't been tried yet, or else the one with the best UCT score.
+// Every legal child counts one more availability.
+func (b *ISMCTSBot) selectChild(node *ismctsNode, moves []move, playerID int, r *rand.Rand) (*ismctsNode, bool) {
+	var legal []*ismctsNode
+	var untried []move
+	for _, m := range moves {
+		var child *ismctsNode
+		for _, c := range node.children {
+			if c.move == m {
+				child = c
+				break
+			}
+		}
+		if child == nil {
+			untried = append(untried, m)
+			continue
+		}
+		child.availability++
+		legal = append(legal, child)
+	}
+
+	if len(untried) > 0 {
+		child := &ismctsNode{parent: node, move: untried[r.Intn(len(untried))], playerID: playerID, availability: 1}
+		node.children = append(node.children, child)
+		return child, true
+	}
+
+	var best *ismctsNode
+	bestScore := math.Inf(-1)
+	for _, child := range legal {
+		score := child.reward/float64(child.visits) + b.config.Exploration*math.Sqrt(math.Log(float64(child.availability))/float64(child.visits))
+		if score > bestScore {
+			best, bestScore = child, score
+		}
+	}
+	return best, false
+}
+
+// rolloutMove picks the next move of a rollout: uniformly at random or, with
+// heuristic rollouts, an escoba if there's one, or else most likely a capture.
+func (b *ISMCTSBot) rolloutMove(g *GameState, moves []move, r *rand.Rand) move {
+	if !b.config.HeuristicRollouts || r.Intn(10) == 0 {
+		return moves[r.Intn(len(moves))]
+	}
+	table := cardSetOf(g.TableCards)
+	isEscoba := g.clearingCountsAsEscoba()
+	captures := 0
+	for _, m := range moves {
+		if isEscoba && m.captured != 0 && m.captured == table {
+			return m
+		}
+		if m.captured != 0 {
+			captures++
+		}
+	}
+	if captures == 0 {
+		return moves[r.Intn(len(moves))]
+	}
+	pick := r.Intn(captures)
+	for _, m := range moves {
+		if m.captured == 0 {
+			continue
+		}
+		if pick == 0 {
+			return m
+		}
+		pick--
+	}
+	return moves[0]
+}
+
+// isSearchOver returns true once the game ends or the set being searched is over
+func isSearchOver(g *GameState, root *GameState) bool {
+	return g.IsEnded || g.SetNumber != root.SetNumber
+}
+
+// searchReward scores the end of a search for playerID, from 0 to 1: a win is
+// 1 and a draw is 0.5, and otherwise the points their side made in the set are
+// compared with the best of the other sides.
+func searchReward(g *GameState, root *GameState, playerID int) float64 {
+	if g.IsEnded {
+		switch {
+		case g.IsWinner(playerID):
+			return 1
+		case g.IsDraw():
+			return 0.5
+		default:
+			return 0
+		}
+	}
+	sideID := g.sideOf(playerID)
+	gain := g.Scores[sideID] - root.Scores[sideID]
+	bestOtherGain := math.MinInt
+	for _, otherID := range g.sideIDs() {
+		if otherID != sideID {
+			bestOtherGain = max(bestOtherGain, g.Scores[otherID]-root.Scores[otherID])
+		}
+	}
+	// A set rarely gives a side more than 6 points more than another
+	return min(1, max(0, 0.5+float64(gain-bestOtherGain)/12))
+}
+
+// runMove runs a move generated by appendMoves, which is always possible
+func runMove(g *GameState, m move) {
+	captured := []Card{}
+	if m.captured != 0 {
+		captured = m.captured.appendCards(make([]Card, 0, m.captured.len()))
+	}
+	if err := g.RunAction(newActionThrowCard(cardsByIndex[m.card], captured)); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,207 @@
+package escoba
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	errMatchIsEnded   = errors.New("match is ended")
+	errGameInProgress = errors.New("current game of the match hasn't ended")
+)
+
+// Match is a series of up to BestOf games, won by the first side (player or, in
+// team mode, team) to win most of them. The first mano rotates around the table
+// from one game to the next.
+type Match struct {
+	// BestOf is the maximum number of games in the match.
+	BestOf int `json:"bestOf"`
+
+	// GameNumber is the number of the current game, starting at 1.
+	GameNumber int `json:"gameNumber"`
+
+	// Game is the current game. When it ends, the match records its result, and
+	// NextGame must be called to continue unless the match is ended too.
+	Game *GameState `json:"game"`
+
+	// Results holds the results of the finished games, in order.
+	Results []GameResult `json:"results"`
+
+	// Wins is the number of games won by each side.
+	Wins map[int]int `json:"wins"`
+
+	// Seed is the seed of the first game; game N is seeded with Seed + N - 1.
+	Seed int64 `json:"seed"`
+
+	IsEnded        bool `json:"isEnded"`
+	WinnerPlayerID int  `json:"winnerPlayerID"` // -1 if the match is a draw or in team mode
+	WinnerTeamID   int  `json:"winnerTeamID"`   // -1 if the match is a draw or not in team mode
+
+	opts []func(*GameState)
+}
+
+// GameResult is the outcome of a finished game of a Match.
+type GameResult struct {
+	Scores         map[int]int `json:"scores"`
+	FirstManoID    int         `json:"firstManoID"`
+	WinnerPlayerID int         `json:"winnerPlayerID"`
+	WinnerTeamID   int         `json:"winnerTeamID"`
+	IsDraw         bool        `json:"isDraw"`
+	EndReason      string      `json:"endReason"`
+}
+
+// NewMatch creates a match of up to bestOf games, each created with the given
+// options (see New), and starts the first one. Options that can't be serialized
+// (e.g. WithShuffler and WithObserver) must be passed again to RestoreMatch.
+//
+// It panics if bestOf is less than 1.
+func NewMatch(bestOf int, opts ...func(*GameState)) *Match {
+	if bestOf < 1 {
+		panic(fmt.Sprintf("escoba: a match must be the best of at least 1 game, got %d", bestOf))
+	}
+	m := &Match{
+		BestOf:         bestOf,
+		GameNumber:     1,
+		Results:        []GameResult{},
+		Wins:           map[int]int{},
+		WinnerPlayerID: -1,
+		WinnerTeamID:   -1,
+		opts:           opts,
+	}
+	m.startGame()
+	m.Seed = m.Game.Seed
+	for _, sideID := range m.Game.sideIDs() {
+		m.Wins[sideID] = 0
+	}
+	return m
+}
+
+// WithMano makes playerID the mano of the first set, instead of player 0.
+func WithMano(playerID int) func(*GameState) {
+	return func(g *GameState) {
+		g.RoundTurnPlayerID = playerID
+		g.LastCapturerPlayerID = playerID
+	}
+}
+
+// RunAction runs the action on the current game, recording its result if it
+// ends the game.
+func (m *Match) RunAction(action Action) error {
+	if m.IsEnded {
+		return newActionError(ACTION_ERROR_GAME_IS_ENDED, "the match is ended")
+	}
+	if m.Game.IsEnded {
+		return newActionError(ACTION_ERROR_GAME_IS_ENDED, "the current game of the match is ended; start the next one")
+	}
+	if err := m.Game.RunAction(action); err != nil {
+		return err
+	}
+	if m.Game.IsEnded {
+		m.recordGame()
+	}
+	return nil
+}
+
+// NextGame starts the next game of the match, once the current one has ended.
+func (m *Match) NextGame() error {
+	if m.IsEnded {
+		return errMatchIsEnded
+	}
+	if !m.Game.IsEnded {
+		return errGameInProgress
+	}
+	m.GameNumber++
+	m.startGame()
+	return nil
+}
+
+// IsWinner returns true if playerID won the match, alone or with their team.
+func (m Match) IsWinner(playerID int) bool {
+	if !m.IsEnded {
+		return false
+	}
+	if m.Game.rules().Teams {
+		return m.WinnerTeamID != -1 && m.WinnerTeamID == m.Game.TeamOf(playerID)
+	}
+	return m.WinnerPlayerID != -1 && m.WinnerPlayerID == playerID
+}
+
+// IsDraw returns true if the match ended in a draw
+func (m Match) IsDraw() bool {
+	return m.IsEnded && m.WinnerPlayerID == -1 && m.WinnerTeamID == -1
+}
+
+// ViewFor returns the match as seen by playerID, with the current game as seen
+// by them (see GameState.ViewFor). The seed is hidden, as it gives away the
+// deals of the remaining games.
+func (m Match) ViewFor(playerID int) Match {
+	view := m
+	view.opts = nil
+	view.Seed = 0
+	game := m.Game.ViewFor(playerID)
+	view.Game = &game
+	view.Wins = copyIntMap(m.Wins)
+	view.Results = make([]GameResult, len(m.Results))
+	for i, result := range m.Results {
+		view.Results[i] = result
+		view.Results[i].Scores = copyIntMap(result.Scores)
+	}
+	return view
+}
+
+// startGame starts the current game. Games after the first one keep the rules and
+// takebacks setting of the game before, so that a match restored with RestoreMatch
+// (which loses its options) carries on as it started.
+func (m *Match) startGame() {
+	opts := append([]func(*GameState){}, m.opts...)
+	if m.GameNumber > 1 {
+		previous := m.Game
+		opts = append(opts, WithSeed(m.Seed+int64(m.GameNumber-1)), func(g *GameState) {
+			g.Rules = previous.rules()
+			g.TakebacksAllowed = previous.TakebacksAllowed
+		})
+	}
+	// The first mano rotates around the table
+	opts = append(opts, func(g *GameState) {
+		WithMano(m.firstManoID(g))(g)
+	})
+	m.Game = New(opts...)
+}
+
+// firstManoID returns the mano of the first set of the current game
+func (m *Match) firstManoID(g *GameState) int {
+	return (m.GameNumber - 1) % g.rules().Players
+}
+
+func (m *Match) recordGame() {
+	g := m.Game
+	result := GameResult{
+		Scores:         copyIntMap(g.Scores),
+		FirstManoID:    m.firstManoID(g),
+		WinnerPlayerID: g.WinnerPlayerID,
+		WinnerTeamID:   g.WinnerTeamID,
+		IsDraw:         g.IsDraw(),
+		EndReason:      g.EndReason,
+	}
+	m.Results = append(m.Results, result)
+
+	winnerSideID := g.WinnerPlayerID
+	if g.rules().Teams {
+		winnerSideID = g.WinnerTeamID
+	}
+	if winnerSideID != -1 {
+		m.Wins[winnerSideID]++
+	}
+
+	// The match ends when a side can't be caught anymore, or after BestOf games
+	decided := winnerSideID != -1 && m.Wins[winnerSideID] > m.BestOf/2
+	if !decided && len(m.Results) < m.BestOf {
+		return
+	}
+	m.IsEnded = true
+	if g.rules().Teams {
+		m.WinnerTeamID = uniqueMaxID(m.Wins)
+	} else {
+		m.WinnerPlayerID = uniqueMaxID(m.Wins)
+	}
+}
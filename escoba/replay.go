@@ -0,0 +1,173 @@
+package escoba
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var (
+	errActionOwnerMismatch  = errors.New("action owner doesn't match the player whose turn it is")
+	errEngineActionMismatch = errors.New("action doesn't match the one recorded by the game")
+)
+
+// Replay rebuilds a game from its initial deal and a list of actions (e.g. the
+// Actions and ActionOwnerPlayerIDs of a finished game), and moves back and forth
+// between the states after each action.
+type Replay struct {
+	actions        []json.RawMessage
+	ownerPlayerIDs []int
+	opts           []func(*GameState)
+
+	// states[i] is the game after running the first i actions. It's filled lazily.
+	states []Snapshot
+	index  int
+	err    *ReplayError
+}
+
+// ReplayError reports the first action of a Replay that can't be reproduced.
+type ReplayError struct {
+	// Index is the index of the offending action.
+	Index int
+
+	// Action is the offending serialized action.
+	Action json.RawMessage
+
+	// Err is the reason why the action can't be reproduced.
+	Err error
+}
+
+func (e *ReplayError) Error() string {
+	return fmt.Sprintf("replaying action %d (%s): %v", e.Index, e.Action, e.Err)
+}
+
+func (e *ReplayError) Unwrap() error {
+	return e.Err
+}
+
+// NewReplay creates a Replay of actions starting from the initial game, which
+// is left untouched. If ownerPlayerIDs is not nil, each action must have been
+// run by the player at the same index, or the replay diverges there.
+//
+// The options are applied every time a state is restored, so games using a
+// custom Shuffler must pass it here too (see GameState.Snapshot).
+func NewReplay(initial *GameState, actions []json.RawMessage, ownerPlayerIDs []int, opts ...func(*GameState)) (*Replay, error) {
+	if ownerPlayerIDs != nil && len(ownerPlayerIDs) != len(actions) {
+		return nil, fmt.Errorf("got %d action owners for %d actions", len(ownerPlayerIDs), len(actions))
+	}
+	return &Replay{
+		actions:        actions,
+		ownerPlayerIDs: ownerPlayerIDs,
+		opts:           opts,
+		states:         []Snapshot{initial.Snapshot()},
+	}, nil
+}
+
+// NewReplayFromSeed creates a Replay of actions on a new game created with the
+// given seed and options, e.g. to reproduce a game from its Seed, Actions and
+// ActionOwnerPlayerIDs.
+func NewReplayFromSeed(seed int64, actions []json.RawMessage, ownerPlayerIDs []int, opts ...func(*GameState)) (*Replay, error) {
+	initial := New(append(append([]func(*GameState){}, opts...), WithSeed(seed))...)
+	return NewReplay(initial, actions, ownerPlayerIDs, opts...)
+}
+
+// Len returns the number of actions in the replay.
+func (r *Replay) Len() int {
+	return len(r.actions)
+}
+
+// Index returns the number of actions run to reach the current state.
+func (r *Replay) Index() int {
+	return r.index
+}
+
+// State returns a copy of the game at the current index.
+func (r *Replay) State() *GameState {
+	g, err := Restore(r.states[r.index], r.opts...)
+	if err != nil {
+		// Snapshots are produced by this package
+		panic(err)
+	}
+	return g
+}
+
+// Forward moves to the state after the next action.
+func (r *Replay) Forward() error {
+	return r.Seek(r.index + 1)
+}
+
+// Backward moves to the state before the last action.
+func (r *Replay) Backward() error {
+	return r.Seek(r.index - 1)
+}
+
+// Seek moves to the state after running the first index actions. If any of
+// them can't be reproduced, it stays at the last reproducible state and
+// returns a *ReplayError.
+func (r *Replay) Seek(index int) error {
+	if index < 0 || index > len(r.actions) {
+		return fmt.Errorf("index %d out of range [0, %d]", index, len(r.actions))
+	}
+	for len(r.states) <= index {
+		if err := r.computeNextState(); err != nil {
+			r.index = len(r.states) - 1
+			return err
+		}
+	}
+	r.index = index
+	return nil
+}
+
+// Verify runs every action and returns the first one that is illegal or
+// diverges from the recorded owners, as a *ReplayError. It doesn't move the
+// current index.
+func (r *Replay) Verify() error {
+	for len(r.states) <= len(r.actions) {
+		if err := r.computeNextState(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Replay) computeNextState() error {
+	if r.err != nil {
+		return r.err
+	}
+
+	i := len(r.states) - 1
+	g, err := Restore(r.states[i], r.opts...)
+	if err != nil {
+		return r.fail(i, err)
+	}
+
+	// Actions run by the game itself (e.g. an initial escoba) were already
+	// recorded when the previous action (or New) dealt the cards
+	if i < len(g.Actions) {
+		if !bytes.Equal(g.Actions[i], r.actions[i]) || (r.ownerPlayerIDs != nil && r.ownerPlayerIDs[i] != g.ActionOwnerPlayerIDs[i]) {
+			return r.fail(i, errEngineActionMismatch)
+		}
+		r.states = append(r.states, r.states[i])
+		return nil
+	}
+
+	action, err := DeserializeAction(r.actions[i])
+	if err != nil {
+		return r.fail(i, err)
+	}
+	if r.ownerPlayerIDs != nil && r.ownerPlayerIDs[i] != g.actionOwnerID(action) {
+		return r.fail(i, errActionOwnerMismatch)
+	}
+	if err := g.RunAction(action); err != nil {
+		return r.fail(i, err)
+	}
+
+	r.states = append(r.states, g.Snapshot())
+	return nil
+}
+
+func (r *Replay) fail(i int, err error) error {
+	r.err = &ReplayError{Index: i, Action: r.actions[i], Err: err}
+	return r.err
+}
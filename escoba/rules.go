@@ -0,0 +1,196 @@
+package escoba
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	// VARIANT_ESCOBA is Escoba de 15: the thrown card and the captured table cards
+	// must add up to Rules.CaptureSum, and la setenta is scored.
+	VARIANT_ESCOBA = "escoba"
+
+	// VARIANT_SCOPA is Italian Scopa: the thrown card captures table cards that add
+	// up to its own value, taking a single matching card before any combination,
+	// and the primiera is scored instead of la setenta.
+	VARIANT_SCOPA = "scopa"
+)
+
+const (
+	// INITIAL_ESCOBA_MANO gives the escoba for an initial table summing to
+	// Rules.CaptureSum to the mano of the set, who is RoundTurnPlayerID.
+	INITIAL_ESCOBA_MANO = "mano"
+
+	// INITIAL_ESCOBA_DEALER gives it to the dealer of the set, who sits before the mano.
+	INITIAL_ESCOBA_DEALER = "dealer"
+
+	// INITIAL_ESCOBA_NONE doesn't count it: the cards stay on the table.
+	INITIAL_ESCOBA_NONE = "none"
+)
+
+const (
+	// TIE_RULE_HIGHER_SCORE makes the player with the highest score win when
+	// several reach the target score in the same set; a tie for it is a draw.
+	TIE_RULE_HIGHER_SCORE = "higher_score"
+
+	// TIE_RULE_DRAW makes it a draw whenever several players reach the target
+	// score in the same set, whatever their scores.
+	TIE_RULE_DRAW = "draw"
+
+	// TIE_RULE_EXTRA_SETS works like TIE_RULE_HIGHER_SCORE, but a tie for the
+	// highest score is broken by playing extra sets until a single player leads.
+	TIE_RULE_EXTRA_SETS = "extra_sets"
+
+	// TIE_RULE_SUDDEN_DEATH works like TIE_RULE_HIGHER_SCORE, but a tie for the
+	// highest score is broken by sudden death: the first of the tied players to
+	// make an escoba wins right away. If a set ends without one, the tied player
+	// who got the most points in it wins, or else another set is played.
+	TIE_RULE_SUDDEN_DEATH = "sudden_death"
+)
+
+// deckSize is the number of cards in a Spanish deck.
+const deckSize = 40
+
+// Rules are the configurable rules of a game. Use DefaultRules as a starting
+// point to play a house variant, e.g. to 21 or 31 points.
+type Rules struct {
+	// Variant is the game played with the deck: VARIANT_ESCOBA or VARIANT_SCOPA.
+	Variant string `json:"variant"`
+
+	// Players is the number of players at the table, from 2 to 4.
+	Players int `json:"players"`
+
+	// Teams makes a 4-player game be played in fixed partnerships: partners sit
+	// across the table and pool their piles and escobas for scoring.
+	Teams bool `json:"teams"`
+
+	// TargetScore is the score that ends the game when a player reaches it.
+	TargetScore int `json:"targetScore"`
+
+	// HandSize is the number of cards dealt to each player every round.
+	HandSize int `json:"handSize"`
+
+	// InitialTableSize is the number of cards dealt to the table at the start of every set.
+	InitialTableSize int `json:"initialTableSize"`
+
+	// CaptureSum is the sum that the thrown card and the captured table cards must add up to.
+	// It's also the sum of the initial table cards that awards an escoba. Scopa ignores it.
+	CaptureSum int `json:"captureSum"`
+
+	// InitialEscoba decides who gets an escoba when the initial table cards sum
+	// to CaptureSum: INITIAL_ESCOBA_MANO, INITIAL_ESCOBA_DEALER or INITIAL_ESCOBA_NONE.
+	InitialEscoba string `json:"initialEscoba"`
+
+	// InitialEscobaThirty awards two escobas when the initial table cards sum to
+	// twice CaptureSum and can be split into two groups that sum to CaptureSum.
+	InitialEscobaThirty bool `json:"initialEscobaThirty"`
+
+	// TieRule decides the game when several players reach TargetScore in the same set.
+	TieRule string `json:"tieRule"`
+
+	// OptionalCapture lets players throw a card to the table even when it could
+	// capture. By default, capturing is mandatory when possible.
+	OptionalCapture bool `json:"optionalCapture"`
+
+	// LastCaptureNotEscoba makes clearing the table with the last card thrown in a
+	// set not count as an escoba, since the cards left on the table go to the last
+	// capturer anyway.
+	LastCaptureNotEscoba bool `json:"lastCaptureNotEscoba"`
+
+	// VictoryClaims lets players claim the win during a set, as soon as the points
+	// they can't lose anymore reach TargetScore (see ActionDeclareVictory).
+	VictoryClaims bool `json:"victoryClaims"`
+
+	// FalseClaimPenalty is the number of points taken from a player who claims
+	// the win without having reached TargetScore.
+	FalseClaimPenalty int `json:"falseClaimPenalty"`
+}
+
+// DefaultRules returns the rules of Escoba de 15.
+//
+// For Scopa, set Variant to VARIANT_SCOPA (and usually TargetScore to 11).
+func DefaultRules() Rules {
+	return Rules{
+		Variant:           VARIANT_ESCOBA,
+		Players:           2,
+		TargetScore:       15,
+		HandSize:          3,
+		InitialTableSize:  4,
+		CaptureSum:        15,
+		InitialEscoba:     INITIAL_ESCOBA_MANO,
+		TieRule:           TIE_RULE_HIGHER_SCORE,
+		FalseClaimPenalty: 2,
+	}
+}
+
+// Validate returns an error if the rules can't be played.
+func (r Rules) Validate() error {
+	switch r.Variant {
+	case VARIANT_ESCOBA, VARIANT_SCOPA:
+	default:
+		return fmt.Errorf("unknown variant %q", r.Variant)
+	}
+	if r.Players < 2 || r.Players > 4 {
+		return fmt.Errorf("players must be between 2 and 4, got %d", r.Players)
+	}
+	if r.Teams && r.Players != 4 {
+		return fmt.Errorf("teams require 4 players, got %d", r.Players)
+	}
+	if r.TargetScore < 1 {
+		return fmt.Errorf("target score must be positive, got %d", r.TargetScore)
+	}
+	if r.HandSize < 1 {
+		return fmt.Errorf("hand size must be positive, got %d", r.HandSize)
+	}
+	if r.InitialTableSize < 0 {
+		return fmt.Errorf("initial table size can't be negative, got %d", r.InitialTableSize)
+	}
+	if r.CaptureSum < 2 {
+		return fmt.Errorf("capture sum must be at least 2, got %d", r.CaptureSum)
+	}
+	if r.FalseClaimPenalty < 0 {
+		return fmt.Errorf("false claim penalty must not be negative, got %d", r.FalseClaimPenalty)
+	}
+	switch r.InitialEscoba {
+	case INITIAL_ESCOBA_MANO, INITIAL_ESCOBA_DEALER, INITIAL_ESCOBA_NONE:
+	default:
+		return fmt.Errorf("unknown initial escoba rule %q", r.InitialEscoba)
+	}
+	switch r.TieRule {
+	case TIE_RULE_HIGHER_SCORE, TIE_RULE_DRAW, TIE_RULE_EXTRA_SETS, TIE_RULE_SUDDEN_DEATH:
+	default:
+		return fmt.Errorf("unknown tie rule %q", r.TieRule)
+	}
+
+	// Every card must be dealt by the end of a set
+	dealtPerRound := r.Players * r.HandSize
+	if r.InitialTableSize >= deckSize || (deckSize-r.InitialTableSize)%dealtPerRound != 0 {
+		return errors.New("the cards left after dealing the table must be dealt to the players in full rounds")
+	}
+	return nil
+}
+
+// WithRules makes the game play by the given rules.
+//
+// It panics if the rules are invalid; use Rules.Validate to check them first.
+func WithRules(rules Rules) func(*GameState) {
+	if err := rules.Validate(); err != nil {
+		panic(fmt.Errorf("escoba: invalid rules: %w", err))
+	}
+	return func(g *GameState) {
+		g.Rules = rules
+	}
+}
+
+// rules returns the game's rules, defaulting to DefaultRules for a zero-value GameState.
+func (g GameState) rules() Rules {
+	if g.Rules == (Rules{}) {
+		return DefaultRules()
+	}
+	return g.Rules
+}
+
+// isScopa returns true if the game is played by the rules of Scopa.
+func (g GameState) isScopa() bool {
+	return g.rules().Variant == VARIANT_SCOPA
+}
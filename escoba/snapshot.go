@@ -0,0 +1,134 @@
+package escoba
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// SnapshotVersion is the version of the Snapshot format produced by this package.
+// Restore also accepts older versions, and rejects any other.
+//
+// Version 2 added the rules, penalties, draw offers, tie-breaks, end reason and
+// takebacks to the state. Version 1 snapshots may lack any of them (or some of
+// the rules), so Restore fills in what's missing with the defaults of New.
+const SnapshotVersion = 2
+
+// minSnapshotVersion is the oldest Snapshot version that Restore accepts.
+const minSnapshotVersion = 1
+
+// Snapshot is a complete copy of a game, including the information that the
+// GameState JSON hides (e.g. the remaining deck order). Unlike the views from
+// GameState.ViewFor, it's meant for persistence, crash recovery and debugging,
+// and must never be sent to players.
+type Snapshot struct {
+	// Version is the format version of the snapshot (see SnapshotVersion).
+	Version int `json:"version"`
+
+	// State is the JSON-serialized GameState.
+	State json.RawMessage `json:"state"`
+
+	// Deck is the remaining deck, in dealing order.
+	Deck []Card `json:"deck"`
+
+	// Initial is the snapshot of the game as it was first dealt, which allows
+	// the restored game to undo actions. It's nil in the initial snapshot itself.
+	Initial *Snapshot `json:"initial,omitempty"`
+}
+
+// Snapshot returns a complete copy of the game, which Restore turns back into
+// an identical GameState.
+//
+// Games using a custom Shuffler (e.g. via WithShuffler or WithCardOrder) must
+// pass the same option to Restore, or later sets will be shuffled from Seed.
+func (g *GameState) Snapshot() Snapshot {
+	state, err := json.Marshal(g)
+	if err != nil {
+		// GameState only contains JSON-friendly types
+		panic(fmt.Errorf("marshalling game state: %w", err))
+	}
+
+	deck := []Card{}
+	if g.deck != nil {
+		deck = append(deck, g.deck.cards...)
+	}
+
+	return Snapshot{Version: SnapshotVersion, State: state, Deck: deck, Initial: g.initial}
+}
+
+// Restore rebuilds the game captured by a Snapshot. The options are applied to
+// the restored game, e.g. to set the Shuffler the original game was using.
+func Restore(s Snapshot, opts ...func(*GameState)) (*GameState, error) {
+	if s.Version < minSnapshotVersion || s.Version > SnapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d (expected %d to %d)", s.Version, minSnapshotVersion, SnapshotVersion)
+	}
+
+	// Fields missing from older snapshots keep the defaults of New
+	g := GameState{
+		WinnerPlayerID:   -1,
+		WinnerTeamID:     -1,
+		Penalties:        map[int]int{},
+		TieBreakSideIDs:  []int{},
+		DrawOfferSideIDs: []int{},
+		Rules:            DefaultRules(),
+	}
+	if err := json.Unmarshal(s.State, &g); err != nil {
+		return nil, fmt.Errorf("unmarshalling game state: %w", err)
+	}
+	if g.Penalties == nil {
+		g.Penalties = map[int]int{}
+	}
+	for _, sideID := range g.sideIDs() {
+		if _, ok := g.Penalties[sideID]; !ok {
+			g.Penalties[sideID] = 0
+		}
+	}
+	if err := g.rules().Validate(); err != nil {
+		return nil, fmt.Errorf("invalid rules: %w", err)
+	}
+	g.deck = &deck{cards: append([]Card{}, s.Deck...)}
+	g.initial = s.Initial
+
+	for _, opt := range opts {
+		opt(&g)
+	}
+
+	return &g, nil
+}
+
+// MatchSnapshot is a complete copy of a match, built on the Snapshot of its
+// current game. Like Snapshot, it must never be sent to players.
+type MatchSnapshot struct {
+	// Match is the JSON-serialized Match.
+	Match json.RawMessage `json:"match"`
+
+	// Game is the snapshot of the current game.
+	Game Snapshot `json:"game"`
+}
+
+// Snapshot returns a complete copy of the match, which RestoreMatch turns back
+// into an identical Match, even in the middle of a game.
+func (m *Match) Snapshot() MatchSnapshot {
+	match, err := json.Marshal(m)
+	if err != nil {
+		// Match only contains JSON-friendly types
+		panic(fmt.Errorf("marshalling match: %w", err))
+	}
+	return MatchSnapshot{Match: match, Game: m.Game.Snapshot()}
+}
+
+// RestoreMatch rebuilds the match captured by a MatchSnapshot. The options are
+// applied to the restored game and to the following games of the match, so
+// options that can't be serialized (e.g. WithShuffler) must be passed again.
+func RestoreMatch(s MatchSnapshot, opts ...func(*GameState)) (*Match, error) {
+	var m Match
+	if err := json.Unmarshal(s.Match, &m); err != nil {
+		return nil, fmt.Errorf("unmarshalling match: %w", err)
+	}
+	game, err := Restore(s.Game, opts...)
+	if err != nil {
+		return nil, err
+	}
+	m.Game = game
+	m.opts = opts
+	return &m, nil
+}
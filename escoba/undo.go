@@ -0,0 +1,62 @@
+package escoba
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	errNothingToUndo   = errors.New("there are no actions to undo")
+	errUndoUnavailable = errors.New("game has no record of its initial deal, so it can't undo actions")
+)
+
+// Undo reverts the last action, as if it had never been run. Captures, escobas,
+// round and set transitions, set scoring and the end of the game are all undone.
+//
+// Actions run by the game itself (e.g. an initial escoba) are undone along with
+// the player action that caused them.
+func (g *GameState) Undo() error {
+	for i := len(g.Actions) - 1; i >= 0; i-- {
+		if !isEngineAction(g.Actions[i]) {
+			return g.UndoTo(i)
+		}
+	}
+	return errNothingToUndo
+}
+
+// UndoTo reverts the game to the state it was in after its first actionIndex
+// actions were run.
+//
+// The game is rebuilt by replaying those actions from the initial deal, so it
+// must have been created by New (or restored from one of its snapshots).
+func (g *GameState) UndoTo(actionIndex int) error {
+	if actionIndex < 0 || actionIndex > len(g.Actions) {
+		return fmt.Errorf("action index %d out of range [0, %d]", actionIndex, len(g.Actions))
+	}
+	if g.initial == nil {
+		return errUndoUnavailable
+	}
+
+	previous, err := Restore(*g.initial)
+	if err != nil {
+		return err
+	}
+	previous.shuffler = g.shuffler
+	for i, bs := range g.Actions[:actionIndex] {
+		if i < len(previous.Actions) {
+			continue // Already run by the game while dealing
+		}
+		action, err := DeserializeAction(bs)
+		if err != nil {
+			return &ReplayError{Index: i, Action: bs, Err: err}
+		}
+		if err := previous.RunAction(action); err != nil {
+			return &ReplayError{Index: i, Action: bs, Err: err}
+		}
+	}
+
+	previous.initial = g.initial
+	previous.observers = g.observers
+	*g = *previous
+	return nil
+}
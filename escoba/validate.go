@@ -0,0 +1,285 @@
+package escoba
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// ErrInvariantViolated is wrapped by every error returned by GameState.Validate.
+var ErrInvariantViolated = errors.New("invariant violated")
+
+// Validate checks every invariant of the game, and returns an error listing the
+// ones that don't hold, or nil if the game is consistent:
+//
+//   - each of the 40 cards is in exactly one of the deck, the hands, the table and the piles,
+//   - the players, sides and turn fields agree with the rules, and hand sizes and
+//     the deck count agree with the turn and round being played,
+//   - the end of the game fields agree with each other,
+//   - the escobas of the current set match the captures in Actions, and the scores
+//     match the points awarded in every set, minus penalties.
+//
+// It's meant for tests and debugging: the last check replays the whole game from
+// its initial deal, so it's only run on games created by New (or restored from one
+// of their snapshots). On a view (see ViewFor), hidden cards are only counted.
+func (g *GameState) Validate() error {
+	var v violations
+	if err := g.rules().Validate(); err != nil {
+		v.add("invalid rules: %v", err)
+		return v.err()
+	}
+	g.validateSeats(&v)
+	g.validateCards(&v)
+	g.validateTurn(&v)
+	g.validateEnd(&v)
+	g.validateHistory(&v)
+	return v.err()
+}
+
+// violations collects the invariants that don't hold
+type violations []error
+
+func (v *violations) add(format string, args ...any) {
+	*v = append(*v, fmt.Errorf("%w: %s", ErrInvariantViolated, fmt.Sprintf(format, args...)))
+}
+
+func (v violations) err() error {
+	return errors.Join(v...)
+}
+
+// validateSeats checks that the maps are keyed by the seated players (or sides)
+// and that every player ID names one of them.
+func (g *GameState) validateSeats(v *violations) {
+	playerIDs, sideIDs := g.PlayerIDs(), g.sideIDs()
+	if keys := sortedKeys(g.Hands); !slices.Equal(keys, playerIDs) {
+		v.add("hands are for players %v, expected %v", keys, playerIDs)
+	}
+	if keys := sortedKeys(g.Piles); !slices.Equal(keys, playerIDs) {
+		v.add("piles are for players %v, expected %v", keys, playerIDs)
+	}
+	if keys := sortedKeys(g.Escobas); !slices.Equal(keys, playerIDs) {
+		v.add("escobas are for players %v, expected %v", keys, playerIDs)
+	}
+	if keys := sortedKeys(g.Scores); !slices.Equal(keys, sideIDs) {
+		v.add("scores are for sides %v, expected %v", keys, sideIDs)
+	}
+	if keys := sortedKeys(g.Penalties); !slices.Equal(keys, sideIDs) {
+		v.add("penalties are for sides %v, expected %v", keys, sideIDs)
+	}
+
+	if !slices.Contains(playerIDs, g.TurnPlayerID) {
+		v.add("turn player %d is not seated", g.TurnPlayerID)
+	}
+	if !slices.Contains(playerIDs, g.RoundTurnPlayerID) {
+		v.add("mano %d is not seated", g.RoundTurnPlayerID)
+	}
+	if !slices.Contains(playerIDs, g.LastCapturerPlayerID) {
+		v.add("last capturer %d is not seated", g.LastCapturerPlayerID)
+	}
+	for _, playerID := range g.ActionOwnerPlayerIDs {
+		if !slices.Contains(playerIDs, playerID) {
+			v.add("action owner %d is not seated", playerID)
+		}
+	}
+	for _, sideID := range append(append([]int{}, g.TieBreakSideIDs...), g.DrawOfferSideIDs...) {
+		if !slices.Contains(sideIDs, sideID) {
+			v.add("tie-break or draw offer side %d doesn't exist", sideID)
+		}
+	}
+	if len(g.Actions) != len(g.ActionOwnerPlayerIDs) {
+		v.add("%d actions but %d action owners", len(g.Actions), len(g.ActionOwnerPlayerIDs))
+	}
+	for _, playerID := range playerIDs {
+		if g.Escobas[playerID] < 0 {
+			v.add("player %d has %d escobas", playerID, g.Escobas[playerID])
+		}
+	}
+	for _, sideID := range sideIDs {
+		// Only penalties take a score below zero
+		if g.Scores[sideID] < -g.Penalties[sideID] || g.Penalties[sideID] < 0 {
+			v.add("side %d has score %d and penalty %d", sideID, g.Scores[sideID], g.Penalties[sideID])
+		}
+	}
+}
+
+// validateCards checks that each card of the deck is in exactly one place
+func (g *GameState) validateCards(v *violations) {
+	seen := make(map[Card]string, deckSize)
+	total := 0
+	count := func(place string, cards []Card) {
+		for _, card := range cards {
+			if other, ok := seen[card]; ok {
+				v.add("%v is both in %s and in %s", card, other, place)
+			}
+			seen[card] = place
+		}
+		total += len(cards)
+	}
+
+	if g.deck != nil {
+		count("the deck", g.deck.cards)
+		if g.DeckCount != len(g.deck.cards) {
+			v.add("deck count is %d, but the deck has %d cards", g.DeckCount, len(g.deck.cards))
+		}
+	} else {
+		total += g.DeckCount
+	}
+	for _, playerID := range sortedKeys(g.Hands) {
+		if hand := g.Hands[playerID]; hand != nil {
+			count(fmt.Sprintf("player %d's hand", playerID), hand.Cards)
+			total += hand.HiddenCount
+		}
+	}
+	count("the table", g.TableCards)
+	for _, playerID := range sortedKeys(g.Piles) {
+		count(fmt.Sprintf("player %d's pile", playerID), g.Piles[playerID])
+	}
+
+	spanishCards := SpanishCards()
+	for card := range seen {
+		if !slices.Contains(spanishCards, card) {
+			v.add("%v is not a Spanish card", card)
+		}
+	}
+	if total != deckSize {
+		v.add("there are %d cards, expected %d", total, deckSize)
+	}
+}
+
+// validateTurn checks that, during a game, hand sizes and the deck count agree
+// with the round and the turn being played.
+func (g *GameState) validateTurn(v *violations) {
+	if g.IsEnded || !slices.Contains(g.PlayerIDs(), g.TurnPlayerID) || !slices.Contains(g.PlayerIDs(), g.RoundTurnPlayerID) || g.Hands[g.TurnPlayerID] == nil {
+		return
+	}
+	rules := g.rules()
+
+	expectedDeckCount := deckSize - rules.InitialTableSize - rules.Players*rules.HandSize*g.RoundNumber
+	if g.DeckCount != expectedDeckCount {
+		v.add("deck count is %d in round %d, expected %d", g.DeckCount, g.RoundNumber, expectedDeckCount)
+	}
+
+	// The players between the mano and the turn player have thrown one more card
+	turnCards := g.Hands[g.TurnPlayerID].Len()
+	if turnCards < 1 || turnCards > rules.HandSize {
+		v.add("player %d has %d cards on their turn", g.TurnPlayerID, turnCards)
+	}
+	offset := func(playerID int) int {
+		return (playerID - g.RoundTurnPlayerID + rules.Players) % rules.Players
+	}
+	for _, playerID := range g.PlayerIDs() {
+		expected := turnCards
+		if offset(playerID) < offset(g.TurnPlayerID) {
+			expected--
+		}
+		if hand := g.Hands[playerID]; hand == nil || hand.Len() != expected {
+			v.add("player %d has %v, expected %d cards", playerID, hand, expected)
+		}
+	}
+}
+
+// validateEnd checks that the winner and end reason agree with IsEnded
+func (g *GameState) validateEnd(v *violations) {
+	if !g.IsEnded {
+		if g.EndReason != "" || g.WinnerPlayerID != -1 || g.WinnerTeamID != -1 {
+			v.add("game isn't ended, but has end reason %q, winner player %d and winner team %d", g.EndReason, g.WinnerPlayerID, g.WinnerTeamID)
+		}
+		return
+	}
+	if g.EndReason == "" {
+		v.add("game is ended without an end reason")
+	}
+	winnerID, otherID := g.WinnerPlayerID, g.WinnerTeamID
+	if g.rules().Teams {
+		winnerID, otherID = g.WinnerTeamID, g.WinnerPlayerID
+	}
+	if otherID != -1 || (winnerID != -1 && !slices.Contains(g.sideIDs(), winnerID)) {
+		v.add("winner player %d and winner team %d don't fit the rules", g.WinnerPlayerID, g.WinnerTeamID)
+	}
+}
+
+// validateHistory replays the game from its initial deal to check that the
+// escobas of the current set match its captures, and that the scores match the
+// points awarded in every set.
+func (g *GameState) validateHistory(v *violations) {
+	if g.initial == nil {
+		return
+	}
+	replayed, err := Restore(*g.initial)
+	if err != nil {
+		v.add("restoring the initial deal: %v", err)
+		return
+	}
+	replayed.shuffler = g.shuffler
+
+	escobas := map[int]int{}
+	expectedScores := map[int]int{}
+	for i, bs := range g.Actions {
+		action, err := DeserializeAction(bs)
+		if err != nil {
+			v.add("action %d can't be deserialized: %v", i, err)
+			return
+		}
+		if i < len(replayed.Actions) {
+			// Already run by the game while dealing
+			if sweep, ok := action.(*ActionInitialEscoba); ok {
+				escobas[sweep.PlayerID] += sweep.Escobas
+			}
+			continue
+		}
+
+		ownerID := replayed.actionOwnerID(action)
+		throw, isThrow := action.(*ActionThrowCard)
+		isEscoba := isThrow && throw.IsEscoba(replayed)
+		provisionalScore := replayed.ProvisionalScore(ownerID)
+		setNumber, lastSetResults := replayed.SetNumber, replayed.LastSetResults
+
+		if err := replayed.RunAction(action); err != nil {
+			v.add("action %d can't be replayed: %v", i, err)
+			return
+		}
+
+		if isEscoba {
+			escobas[ownerID]++
+			if replayed.EndReason == END_REASON_SUDDEN_DEATH {
+				expectedScores[replayed.sideOf(ownerID)]++
+			}
+		}
+		if sweep, ok := replayed.lastAction().(*ActionInitialEscoba); ok && replayed.EndReason == END_REASON_SUDDEN_DEATH && replayed.SetNumber != setNumber {
+			// The sweep on the deal of the next set broke the tie
+			expectedScores[replayed.sideOf(sweep.PlayerID)]++
+		}
+		if replayed.EndReason == END_REASON_VICTORY_CLAIM {
+			// The claimed score includes the points of the unfinished set
+			expectedScores[replayed.sideOf(ownerID)] = provisionalScore + replayed.Penalties[replayed.sideOf(ownerID)]
+		}
+		if replayed.LastSetResults != lastSetResults {
+			for sideID, points := range replayed.LastSetResults.PointsAwarded {
+				expectedScores[sideID] += points
+			}
+		}
+		if replayed.SetNumber != setNumber {
+			escobas = map[int]int{}
+		}
+	}
+
+	for _, playerID := range g.PlayerIDs() {
+		if g.Escobas[playerID] != escobas[playerID] {
+			v.add("player %d has %d escobas, but made %d this set", playerID, g.Escobas[playerID], escobas[playerID])
+		}
+	}
+	for _, sideID := range g.sideIDs() {
+		if expected := expectedScores[sideID] - g.Penalties[sideID]; g.Scores[sideID] != expected {
+			v.add("side %d has score %d, expected %d", sideID, g.Scores[sideID], expected)
+		}
+	}
+}
+
+// lastAction returns the last action run in the game, or nil if there's none
+func (g *GameState) lastAction() Action {
+	if len(g.Actions) == 0 {
+		return nil
+	}
+	action, _ := DeserializeAction(g.Actions[len(g.Actions)-1])
+	return action
+}
@@ -0,0 +1,68 @@
+package escoba
+
+import "encoding/json"
+
+// ViewFor returns the game as seen by playerID, safe to send to that player.
+//
+// Other players' hands are redacted to a card count (see Hand.HiddenCount), the
+// deck contents and the seed are hidden (only DeckCount remains), and
+// PossibleActions lists the actions playerID may run, even out of turn (see
+// CalculatePossibleActionsFor). Passing a player ID that isn't seated (e.g. -1)
+// produces a spectator view, with every hand hidden.
+//
+// The returned GameState shares no maps or slices with g, and it cannot run
+// actions (see Determinize to sample a complete game from it).
+func (g GameState) ViewFor(playerID int) GameState {
+	view := g
+	view.deck = nil
+	view.shuffler = nil
+	view.observers = nil
+	view.initial = nil
+	view.Seed = 0
+
+	view.Hands = make(map[int]*Hand, len(g.Hands))
+	for id, hand := range g.Hands {
+		if hand == nil {
+			view.Hands[id] = nil
+			continue
+		}
+		if id == playerID {
+			view.Hands[id] = &Hand{Cards: append([]Card{}, hand.Cards...)}
+			continue
+		}
+		view.Hands[id] = &Hand{Cards: []Card{}, HiddenCount: hand.Len()}
+	}
+
+	view.TableCards = append([]Card{}, g.TableCards...)
+	view.Piles = make(map[int][]Card, len(g.Piles))
+	for id, pile := range g.Piles {
+		view.Piles[id] = append([]Card{}, pile...)
+	}
+	view.Escobas = copyIntMap(g.Escobas)
+	view.Scores = copyIntMap(g.Scores)
+	view.Penalties = copyIntMap(g.Penalties)
+	view.LastSetResults = g.LastSetResults.clone()
+	view.Actions = append([]json.RawMessage{}, g.Actions...)
+	view.ActionOwnerPlayerIDs = append([]int{}, g.ActionOwnerPlayerIDs...)
+	view.TieBreakSideIDs = append([]int{}, g.TieBreakSideIDs...)
+
+	if playerID == g.TurnPlayerID {
+		view.PossibleActions = append([]json.RawMessage{}, g.PossibleActions...)
+	} else {
+		view.PossibleActions = _serializeActions(g.CalculatePossibleActionsFor(playerID))
+	}
+	view.DrawOfferSideIDs = append([]int{}, g.DrawOfferSideIDs...)
+
+	return view
+}
+
+func copyIntMap(m map[int]int) map[int]int {
+	if m == nil {
+		return nil
+	}
+	c := make(map[int]int, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+	return c
+}
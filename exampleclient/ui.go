@@ -15,6 +15,12 @@ import (
 type ui struct {
 	wantKeyPressCh chan struct{}
 	sendKeyPressCh chan rune
+
+	// match is the match the rendered game belongs to
+	match escoba.Match
+
+	// lastError explains why the server rejected the last action, if it did
+	lastError string
 }
 
 func NewUI() *ui {
@@ -63,6 +69,7 @@ type printMode int
 const (
 	PRINT_MODE_NORMAL printMode = iota
 	PRINT_MODE_SHOW_SET_RESULT
+	PRINT_MODE_GAME_END
 	PRINT_MODE_END
 )
 
@@ -75,42 +82,54 @@ func (u *ui) render(playerID int, state escoba.GameState, mode printMode) error
 	var (
 		mx, my = termbox.Size()
 		you    = playerID
-		them   = state.OpponentOf(you)
+		others = otherPlayerIDs(state, you)
 	)
 
-	// Display opponent's hand (face down)
-	opponentHand := state.Hands[them]
-	if opponentHand != nil {
-		unrevealed := strings.Repeat("[] ", len(opponentHand.Cards))
-		printAt(0, 0, unrevealed)
+	// Display opponents' hands (face down)
+	for i, them := range others {
+		opponentHand := state.Hands[them]
+		if opponentHand == nil {
+			continue
+		}
+		unrevealed := strings.Repeat("[] ", opponentHand.Len())
+		if len(others) > 1 {
+			unrevealed = fmt.Sprintf("%v: %v", playerName(state, you, them), unrevealed)
+		}
+		printAt(0, i, unrevealed)
 	}
 
 	// Display round and game info
 	printUpToAt(mx-1, 0, fmt.Sprintf("Ronda %d", state.RoundNumber))
 
-	youMano := ""
-	themMano := ""
-	if state.RoundTurnPlayerID == you {
-		youMano = " (mano)"
-	} else {
-		themMano = " (mano)"
+	pileInfos := []string{}
+	for i, id := range append([]int{you}, others...) {
+		mano := ""
+		if state.RoundTurnPlayerID == id {
+			mano = " (mano)"
+		}
+		printUpToAt(mx-1, i+1, fmt.Sprintf("%v%v: %v puntos", playerName(state, you, id), mano, state.ScoreOf(id)))
+		pileInfos = append(pileInfos, fmt.Sprintf("%v: %d (escobas: %d)", playerName(state, you, id), len(state.Piles[id]), state.Escobas[id]))
+	}
+	printUpToAt(mx-1, len(others)+2, fmt.Sprintf("Se juega a %v puntos", state.Rules.TargetScore))
+	if u.match.BestOf > 1 {
+		printUpToAt(mx-1, len(others)+3, fmt.Sprintf("Partida %d (al mejor de %d) - %v", u.match.GameNumber, u.match.BestOf, matchWinsString(u.match, you)))
 	}
 
-	printUpToAt(mx-1, 1, fmt.Sprintf("Vos%v: %v puntos", youMano, state.Scores[you]))
-	printUpToAt(mx-1, 2, fmt.Sprintf("Oponente%v: %v puntos", themMano, state.Scores[them]))
+	// Display tie-break info
+	if len(state.TieBreakSideIDs) > 0 {
+		tieBreak := "¡Desempate! Se juegan sets extra hasta que alguien quede adelante"
+		if state.Rules.TieRule == escoba.TIE_RULE_SUDDEN_DEATH {
+			tieBreak = "¡Desempate a muerte súbita! La próxima escoba gana"
+		}
+		printAt(0, my/2-3, tieBreak)
+	}
 
 	// Display table cards
 	tableCardsStr := "Mesa: " + getCardsString(state.TableCards, false, false)
 	printAt(0, my/2-2, tableCardsStr)
 
 	// Display captured piles info
-	youPileCount := len(state.Piles[you])
-	themPileCount := len(state.Piles[them])
-	youEscobas := state.Escobas[you]
-	themEscobas := state.Escobas[them]
-
-	pileInfo := fmt.Sprintf("Cartas capturadas - Vos: %d (escobas: %d), Oponente: %d (escobas: %d)",
-		youPileCount, youEscobas, themPileCount, themEscobas)
+	pileInfo := "Cartas capturadas - " + strings.Join(pileInfos, ", ")
 	printAt(0, my/2-1, pileInfo)
 
 	// Display your hand
@@ -127,25 +146,57 @@ func (u *ui) render(playerID int, state escoba.GameState, mode printMode) error
 	case PRINT_MODE_SHOW_SET_RESULT:
 		if state.LastSetResults != nil {
 			result := state.LastSetResults
-			resultStr := fmt.Sprintf("Terminó el mazo. Puntos obtenidos - Vos: %d, Oponente: %d",
-				result.PointsAwarded[you], result.PointsAwarded[them])
+			points := []string{}
+			if result.ByTeam {
+				points = append(points, fmt.Sprintf("Tu equipo: %d", result.PointsAwarded[state.TeamOf(you)]))
+				points = append(points, fmt.Sprintf("Equipo rival: %d", result.PointsAwarded[state.TeamOf(state.NextPlayerID(you))]))
+			} else {
+				for _, id := range append([]int{you}, others...) {
+					points = append(points, fmt.Sprintf("%v: %d", playerName(state, you, id), result.PointsAwarded[id]))
+				}
+			}
+			resultStr := "Terminó el mazo. Puntos obtenidos - " + strings.Join(points, ", ")
 			printAt(0, my/2, resultStr)
 		}
+	case PRINT_MODE_GAME_END:
+		if state.IsDraw() {
+			printAt(0, my/2, "La partida terminó empatada 🤝 Sigue la siguiente...")
+		} else if state.IsWinner(playerID) {
+			printAt(0, my/2, "¡Ganaste la partida! Sigue la siguiente...")
+		} else {
+			printAt(0, my/2, "Perdiste la partida. Sigue la siguiente...")
+		}
 	case PRINT_MODE_END:
-		if playerID == state.WinnerPlayerID {
+		if u.match.BestOf > 1 {
+			if u.match.IsDraw() {
+				printAt(0, my/2, "El match terminó empatado 🤝")
+			} else if u.match.IsWinner(playerID) {
+				printAt(0, my/2, "¡Ganaste el match! 🥰")
+			} else {
+				printAt(0, my/2, "Perdiste el match 😭")
+			}
+		} else if state.IsDraw() {
+			printAt(0, my/2, "La partida terminó empatada 🤝")
+		} else if state.EndReason == escoba.END_REASON_RESIGNATION && state.IsWinner(playerID) {
+			printAt(0, my/2, "¡Ganaste la partida por abandono! 🥰")
+		} else if state.IsWinner(playerID) {
 			printAt(0, my/2, "¡Ganaste la partida! 🥰")
 		} else {
 			printAt(0, my/2, "Perdiste la partida 😭")
 		}
 	}
 
-	if mode == PRINT_MODE_SHOW_SET_RESULT || mode == PRINT_MODE_END {
+	if mode == PRINT_MODE_SHOW_SET_RESULT || mode == PRINT_MODE_GAME_END || mode == PRINT_MODE_END {
 		printAt(0, my-2, "Presioná cualquier tecla para continuar...")
 		termbox.Flush()
 		u.pressAnyKey()
 		return nil
 	}
 
+	if u.lastError != "" {
+		printAt(0, my-3, u.lastError)
+	}
+
 	if state.TurnPlayerID == playerID {
 		if mode == PRINT_MODE_NORMAL {
 			actionsString := ""
@@ -163,6 +214,41 @@ func (u *ui) render(playerID int, state escoba.GameState, mode printMode) error
 	return nil
 }
 
+// otherPlayerIDs returns the IDs of the other players, in turn order after playerID
+func otherPlayerIDs(state escoba.GameState, playerID int) []int {
+	others := []int{}
+	for id := state.NextPlayerID(playerID); id != playerID; id = state.NextPlayerID(id) {
+		others = append(others, id)
+	}
+	return others
+}
+
+func playerName(state escoba.GameState, you int, playerID int) string {
+	if playerID == you {
+		return "Vos"
+	}
+	if state.Rules.Players == 2 {
+		return "Oponente"
+	}
+	if state.Rules.Teams && state.PartnerOf(you) == playerID {
+		return fmt.Sprintf("Jugador %d (compañero)", playerID+1)
+	}
+	return fmt.Sprintf("Jugador %d", playerID+1)
+}
+
+// matchWinsString returns the games won so far in the match by each side
+func matchWinsString(match escoba.Match, you int) string {
+	if match.Game.Rules.Teams {
+		yourTeam := match.Game.TeamOf(you)
+		return fmt.Sprintf("ganadas: tu equipo %d, equipo rival %d", match.Wins[yourTeam], match.Wins[1-yourTeam])
+	}
+	wins := []string{}
+	for _, id := range append([]int{you}, otherPlayerIDs(*match.Game, you)...) {
+		wins = append(wins, fmt.Sprintf("%v %d", playerName(*match.Game, you, id), match.Wins[id]))
+	}
+	return "ganadas: " + strings.Join(wins, ", ")
+}
+
 func printAt(x, y int, s string) {
 	_s := []rune(s)
 	for i, r := range _s {
@@ -216,25 +302,24 @@ func getLastActionString(playerID int, state escoba.GameState) string {
 	if len(state.Actions) == 0 {
 		return "¡Empezó el juego!"
 	}
-	if state.RoundJustStarted {
-		return "¡Empezó la ronda!"
-	}
 
 	lastActionBs := state.Actions[len(state.Actions)-1]
 	lastActionOwnerPlayerID := state.ActionOwnerPlayerIDs[len(state.ActionOwnerPlayerIDs)-1]
-	return getActionString(lastActionBs, lastActionOwnerPlayerID, playerID)
+	if state.RoundJustStarted && !isInitialEscoba(lastActionBs) {
+		return "¡Empezó la ronda!"
+	}
+	return getActionString(state, lastActionBs, lastActionOwnerPlayerID, playerID)
 }
 
-func getActionString(lastActionBs json.RawMessage, lastActionOwnerPlayerID int, playerID int) string {
+func getActionString(state escoba.GameState, lastActionBs json.RawMessage, lastActionOwnerPlayerID int, playerID int) string {
 	lastAction, err := escoba.DeserializeAction(lastActionBs)
 	if err != nil {
 		return "Error deserializando acción"
 	}
 
 	threw := "tiraste"
-	who := "Vos"
+	who := playerName(state, playerID, lastActionOwnerPlayerID)
 	if playerID != lastActionOwnerPlayerID {
-		who = "Oponente"
 		threw = "tiró"
 	}
 
@@ -249,6 +334,46 @@ func getActionString(lastActionBs json.RawMessage, lastActionOwnerPlayerID int,
 		} else {
 			what = fmt.Sprintf("%v %v a la mesa", threw, cardStr)
 		}
+	case escoba.INITIAL_ESCOBA:
+		action := lastAction.(*escoba.ActionInitialEscoba)
+		capturedStr := getCardsString(action.Cards, false, false)
+		took := "te llevaste"
+		if playerID != lastActionOwnerPlayerID {
+			took = "se llevó"
+		}
+		escobas := "una escoba"
+		if action.Escobas > 1 {
+			escobas = fmt.Sprintf("%d escobas", action.Escobas)
+		}
+		what = fmt.Sprintf("%v %v de mano: %v", took, escobas, capturedStr)
+	case escoba.RESIGN:
+		what = "abandonó la partida"
+		if playerID == lastActionOwnerPlayerID {
+			what = "abandonaste la partida"
+		}
+	case escoba.OFFER_DRAW:
+		what = "ofreció empate"
+		if playerID == lastActionOwnerPlayerID {
+			what = "ofreciste empate"
+		}
+	case escoba.ACCEPT_DRAW:
+		what = "aceptó el empate"
+		if playerID == lastActionOwnerPlayerID {
+			what = "aceptaste el empate"
+		}
+	case escoba.DECLINE_DRAW:
+		what = "rechazó el empate"
+		if playerID == lastActionOwnerPlayerID {
+			what = "rechazaste el empate"
+		}
+	case escoba.DECLARE_VICTORY:
+		what = "cantó victoria"
+		if playerID == lastActionOwnerPlayerID {
+			what = "cantaste victoria"
+		}
+		if !state.IsEnded {
+			what += fmt.Sprintf(", pero no llegaba a %v puntos (penalización de %v)", state.Rules.TargetScore, state.Rules.FalseClaimPenalty)
+		}
 	default:
 		what = "acción desconocida"
 	}
@@ -256,6 +381,11 @@ func getActionString(lastActionBs json.RawMessage, lastActionOwnerPlayerID int,
 	return fmt.Sprintf("%v %v", who, what)
 }
 
+func isInitialEscoba(actionBs json.RawMessage) bool {
+	action, err := escoba.DeserializeAction(actionBs)
+	return err == nil && action.GetName() == escoba.INITIAL_ESCOBA
+}
+
 func (u *ui) startKeyEventLoop() {
 	keyPressesCh := make(chan termbox.Event)
 	go func() {
@@ -311,11 +441,46 @@ func spanishAction(action escoba.Action) string {
 		} else {
 			return fmt.Sprintf("%v (a mesa)", cardStr)
 		}
+	case escoba.DECLARE_VICTORY:
+		return "¡Cantar victoria!"
+	case escoba.RESIGN:
+		return "Abandonar"
+	case escoba.OFFER_DRAW:
+		return "Ofrecer empate"
+	case escoba.ACCEPT_DRAW:
+		return "Aceptar empate"
+	case escoba.DECLINE_DRAW:
+		return "Rechazar empate"
 	default:
 		return "???"
 	}
 }
 
+func spanishActionError(err escoba.ActionError) string {
+	switch err.Reason {
+	case escoba.ACTION_ERROR_GAME_IS_ENDED:
+		return "La partida terminó"
+	case escoba.ACTION_ERROR_NOT_YOUR_TURN:
+		return "No es tu turno"
+	case escoba.ACTION_ERROR_WRONG_PLAYER:
+		return "No podés jugar por otro jugador"
+	case escoba.ACTION_ERROR_CARD_NOT_IN_HAND:
+		return "Esa carta no está en tu mano"
+	case escoba.ACTION_ERROR_CARD_NOT_ON_TABLE:
+		return "Esas cartas no están en la mesa"
+	case escoba.ACTION_ERROR_WRONG_SUM:
+		return "Esas cartas no suman lo necesario"
+	case escoba.ACTION_ERROR_CAPTURE_IS_MANDATORY:
+		return "Es obligatorio capturar"
+	case escoba.ACTION_ERROR_MATCHING_CARD_FIRST:
+		return "Primero hay que levantar la carta del mismo valor"
+	case escoba.ACTION_ERROR_NOT_ALLOWED:
+		return "Esa acción no está permitida ahora"
+	default:
+		return fmt.Sprintf("Acción inválida: %v", err.Details)
+	}
+}
+
 func _deserializeActions(as []json.RawMessage) []escoba.Action {
 	_as := []escoba.Action{}
 	for _, a := range as {
@@ -1,6 +1,7 @@
 package exampleclient
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
 
@@ -23,18 +24,55 @@ func Player(playerID int, address string) {
 		log.Fatal(err)
 	}
 
-	lastRound := 0
+	var (
+		lastRound = 0
+		match     *escoba.Match
+	)
 	for {
-		gameState, err := server.WsReadMessage[escoba.GameState, server.MessageHeresGameState](conn, server.MessageTypeHeresGameState)
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			log.Fatalf("Failed to read message from server: %v", err)
+		}
+		var wsMessage server.WebsocketMessage
+		if err := json.Unmarshal(message, &wsMessage); err != nil {
+			log.Fatalf("Failed to unmarshal message: %v", err)
+		}
+
+		if wsMessage.Type == server.MessageTypeError && match != nil {
+			// The server rejected the action, so play the turn again
+			actionErr, err := server.WsDeserializeMessage[escoba.ActionError, server.MessageError](message, server.MessageTypeError)
+			if err != nil {
+				log.Fatal(err)
+			}
+			ui.lastError = spanishActionError(*actionErr)
+			if err := playTurn(conn, ui, playerID, *match.Game); err != nil {
+				log.Fatal(err)
+			}
+			continue
+		}
+
+		match, err = server.WsDeserializeMessage[escoba.Match, server.MessageHeresMatch](message, server.MessageTypeHeresMatch)
 		if err != nil {
 			log.Fatal(err)
 		}
+		ui.match = *match
+		ui.lastError = ""
+		gameState := match.Game
 
-		if gameState.IsEnded {
+		if match.IsEnded {
 			_ = ui.render(playerID, *gameState, PRINT_MODE_END)
 			return
 		}
 
+		if gameState.IsEnded {
+			// The server starts the next game of the match right away
+			if err := ui.render(playerID, *gameState, PRINT_MODE_GAME_END); err != nil {
+				log.Fatal(err)
+			}
+			lastRound = 0
+			continue
+		}
+
 		if gameState.LastSetResults != nil && lastRound != 0 {
 			err := ui.render(playerID, *gameState, PRINT_MODE_SHOW_SET_RESULT)
 			if err != nil {
@@ -50,14 +88,18 @@ func Player(playerID int, address string) {
 			continue
 		}
 
-		action, err := ui.play(playerID, *gameState)
-		if err != nil {
-			log.Fatal("Invalid action:", err)
-		}
-
-		msg, _ := server.NewMessageAction(action)
-		if err := server.WsSend(conn, msg); err != nil {
+		if err := playTurn(conn, ui, playerID, *gameState); err != nil {
 			log.Fatal(err)
 		}
 	}
 }
+
+func playTurn(conn *websocket.Conn, ui *ui, playerID int, gameState escoba.GameState) error {
+	action, err := ui.play(playerID, gameState)
+	if err != nil {
+		return fmt.Errorf("invalid action: %w", err)
+	}
+
+	msg, _ := server.NewMessageAction(action)
+	return server.WsSend(conn, msg)
+}
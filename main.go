@@ -6,7 +6,9 @@ package main
 import (
 	"fmt"
 	"os"
+	"strconv"
 
+	"github.com/marianogappa/escoba/escoba"
 	"github.com/marianogappa/escoba/exampleclient"
 	"github.com/marianogappa/escoba/server"
 )
@@ -14,8 +16,13 @@ import (
 func main() {
 	if len(os.Args) < 2 {
 		fmt.Println("usage: escoba server")
-		fmt.Println("usage: escoba player1|player2 [address]")
+		fmt.Println("usage: escoba player1|player2|player3|player4 [address]")
 		fmt.Println("Define the PORT environment variable for escoba server to change the default port (8080).")
+		fmt.Println("Define TAKEBACKS=true for escoba server to let players agree to undo actions.")
+		fmt.Println("Define PLAYERS=3 or PLAYERS=4 for escoba server to play with more than 2 players.")
+		fmt.Println("Define TEAMS=true (with PLAYERS=4) for escoba server to play in partnerships of 2.")
+		fmt.Println("Define BEST_OF=3 (or any number of games) for escoba server to play a match.")
+		fmt.Println("Define DEBUG=true for escoba server to check the game's invariants after every action.")
 		os.Exit(0)
 	}
 	port := os.Getenv("PORT")
@@ -31,11 +38,46 @@ func main() {
 	arg := os.Args[1]
 	switch arg {
 	case "server":
-		server.New(port).Start()
+		var opts []func(*escoba.GameState)
+		if os.Getenv("TAKEBACKS") == "true" {
+			opts = append(opts, escoba.WithTakebacks())
+		}
+		rules := escoba.DefaultRules()
+		if players := os.Getenv("PLAYERS"); players != "" {
+			n, err := strconv.Atoi(players)
+			if err != nil {
+				fmt.Println("Invalid PLAYERS:", err)
+				os.Exit(1)
+			}
+			rules.Players = n
+		}
+		rules.Teams = os.Getenv("TEAMS") == "true"
+		if err := rules.Validate(); err != nil {
+			fmt.Println("Invalid rules:", err)
+			os.Exit(1)
+		}
+		opts = append(opts, escoba.WithRules(rules))
+		bestOf := 1
+		if n := os.Getenv("BEST_OF"); n != "" {
+			var err error
+			if bestOf, err = strconv.Atoi(n); err != nil || bestOf < 1 {
+				fmt.Println("Invalid BEST_OF:", n)
+				os.Exit(1)
+			}
+		}
+		s := server.NewMatch(port, bestOf, opts...)
+		if os.Getenv("DEBUG") == "true" {
+			s.EnableDebug()
+		}
+		s.Start()
 	case "player1":
 		exampleclient.Player(0, address)
 	case "player2":
 		exampleclient.Player(1, address)
+	case "player3":
+		exampleclient.Player(2, address)
+	case "player4":
+		exampleclient.Player(3, address)
 	default:
 		fmt.Println("Invalid argument. Please provide either server or client.")
 	}
@@ -7,6 +7,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"syscall/js"
+	"time"
 
 	"github.com/marianogappa/escoba/escoba"
 )
@@ -15,20 +16,92 @@ func main() {
 	js.Global().Set("escobaNew", js.FuncOf(escobaNew))
 	js.Global().Set("escobaRunAction", js.FuncOf(escobaRunAction))
 	js.Global().Set("escobaBotRunAction", js.FuncOf(escobaBotRunAction))
+	js.Global().Set("escobaNewMatch", js.FuncOf(escobaNewMatch))
+	js.Global().Set("escobaMatch", js.FuncOf(escobaMatch))
+	js.Global().Set("escobaNextGame", js.FuncOf(escobaNextGame))
+	js.Global().Set("escobaSetDifficulty", js.FuncOf(escobaSetDifficulty))
 	select {}
 }
 
+// humanPlayerID is the seat of the human player; the bot plays the other seat.
+const humanPlayerID = 0
+
 var (
+	// match holds the game being played; a single game is a match of 1
+	match *escoba.Match
 	state *escoba.GameState
 	bot   escoba.Bot
+
+	// difficulty is the bot's level for new matches: "easy" or "hard"
+	difficulty = "easy"
 )
 
+// escobaSetDifficulty sets the bot's level to p[0]: "easy" plays greedily, and
+// "hard" searches with ISMCTS. It applies to the current match too.
+func escobaSetDifficulty(this js.Value, p []js.Value) interface{} {
+	level := p[0].String()
+	if level != "easy" && level != "hard" {
+		panic(fmt.Errorf("unknown difficulty: %v", level))
+	}
+	difficulty = level
+	bot = newBot()
+	return nil
+}
+
+// newBot creates a bot for the current difficulty
+func newBot() escoba.Bot {
+	if difficulty == "hard" {
+		// The browser runs a single thread, so it's all about the time budget
+		config := escoba.DefaultISMCTSConfig()
+		config.Iterations = 0
+		config.TimeBudget = 700 * time.Millisecond
+		config.Workers = 1
+		return escoba.NewISMCTSBot(config)
+	}
+	return escoba.NewBot()
+}
+
 func escobaNew(this js.Value, p []js.Value) interface{} {
-	// Escoba doesn't have configurable rules like truco, so we create a standard game
-	state = escoba.New()
-	bot = escoba.NewBot()
+	// Optionally, the first argument is the JSON-serialized escoba.Rules to play by
+	_newMatch(1, p)
+
+	nbs, err := json.Marshal(state.ViewFor(humanPlayerID))
+	if err != nil {
+		panic(err)
+	}
+
+	buffer := js.Global().Get("Uint8Array").New(len(nbs))
+	js.CopyBytesToJS(buffer, nbs)
+	return buffer
+}
 
-	nbs, err := json.Marshal(state)
+// escobaNewMatch starts a match of up to p[0] games. Optionally, the second
+// argument is the JSON-serialized escoba.Rules to play by. It returns the match.
+func escobaNewMatch(this js.Value, p []js.Value) interface{} {
+	_newMatch(p[0].Int(), p[1:])
+	return escobaMatch(this, nil)
+}
+
+// escobaMatch returns the current match, including the results of its finished games.
+func escobaMatch(this js.Value, p []js.Value) interface{} {
+	nbs, err := json.Marshal(match.ViewFor(humanPlayerID))
+	if err != nil {
+		panic(fmt.Errorf("marshalling match: %w", err))
+	}
+
+	buffer := js.Global().Get("Uint8Array").New(len(nbs))
+	js.CopyBytesToJS(buffer, nbs)
+	return buffer
+}
+
+// escobaNextGame starts the next game of the match, once the current one has ended.
+func escobaNextGame(this js.Value, p []js.Value) interface{} {
+	if err := match.NextGame(); err != nil {
+		panic(fmt.Errorf("starting next game: %w", err))
+	}
+	state = match.Game
+
+	nbs, err := json.Marshal(state.ViewFor(humanPlayerID))
 	if err != nil {
 		panic(err)
 	}
@@ -38,6 +111,25 @@ func escobaNew(this js.Value, p []js.Value) interface{} {
 	return buffer
 }
 
+func _newMatch(bestOf int, p []js.Value) {
+	var opts []func(*escoba.GameState)
+	if len(p) > 0 {
+		rulesBytes := make([]byte, p[0].Length())
+		js.CopyBytesToGo(rulesBytes, p[0])
+		rules := escoba.DefaultRules()
+		if err := json.Unmarshal(rulesBytes, &rules); err != nil {
+			panic(fmt.Errorf("unmarshalling rules: %w", err))
+		}
+		if err := rules.Validate(); err != nil {
+			panic(fmt.Errorf("invalid rules: %w", err))
+		}
+		opts = append(opts, escoba.WithRules(rules))
+	}
+	match = escoba.NewMatch(bestOf, opts...)
+	state = match.Game
+	bot = newBot()
+}
+
 func escobaRunAction(this js.Value, p []js.Value) interface{} {
 	jsonBytes := make([]byte, p[0].Length())
 	js.CopyBytesToGo(jsonBytes, p[0])
@@ -54,13 +146,13 @@ func escobaBotRunAction(this js.Value, p []js.Value) interface{} {
 		action := bot.ChooseAction(*state)
 		// fmt.Println("Action chosen by bot:", action)
 
-		err := state.RunAction(action)
+		err := match.RunAction(action)
 		if err != nil {
 			panic(fmt.Errorf("running action: %w", err))
 		}
 	}
 
-	nbs, err := json.Marshal(state)
+	nbs, err := json.Marshal(state.ViewFor(humanPlayerID))
 	if err != nil {
 		panic(fmt.Errorf("marshalling game state: %w", err))
 	}
@@ -75,11 +167,11 @@ func _runAction(bs []byte) []byte {
 	if err != nil {
 		panic(err)
 	}
-	err = state.RunAction(action)
+	err = match.RunAction(action)
 	if err != nil {
 		panic(err)
 	}
-	nbs, err := json.Marshal(state)
+	nbs, err := json.Marshal(state.ViewFor(humanPlayerID))
 	if err != nil {
 		panic(err)
 	}
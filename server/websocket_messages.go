@@ -2,6 +2,7 @@ package server
 
 import (
 	"encoding/json"
+	"errors"
 
 	"github.com/marianogappa/escoba/escoba"
 )
@@ -11,6 +12,9 @@ const (
 	MessageTypeHeresGameState
 	MessageTypeAction
 	MessageTypeGimmeGameState
+	MessageTypeTakeback
+	MessageTypeHeresMatch
+	MessageTypeError
 )
 
 type IWebsocketMessage[T any] interface {
@@ -55,6 +59,40 @@ func (gs MessageHeresGameState) Deserialize() (escoba.GameState, error) {
 	return gameState, err
 }
 
+// MessageHeresMatch sends the match (with its current game) as seen by the receiving player.
+type MessageHeresMatch struct {
+	WebsocketMessage
+	Match json.RawMessage `json:"match"`
+}
+
+func NewMessageHeresMatch(match escoba.Match) (MessageHeresMatch, error) {
+	bs, err := json.Marshal(match)
+	return MessageHeresMatch{WebsocketMessage: WebsocketMessage{Type: MessageTypeHeresMatch}, Match: bs}, err
+}
+
+func (m MessageHeresMatch) Deserialize() (escoba.Match, error) {
+	var match escoba.Match
+	err := json.Unmarshal(m.Match, &match)
+	return match, err
+}
+
+// MessageError tells a player why the action they sent couldn't be run.
+type MessageError struct {
+	WebsocketMessage
+	Error escoba.ActionError `json:"error"`
+}
+
+// NewMessageError creates an error message, keeping the reason of an *escoba.ActionError.
+func NewMessageError(err error) MessageError {
+	actionErr := &escoba.ActionError{Reason: escoba.ACTION_ERROR_INVALID_ACTION, Details: err.Error()}
+	_ = errors.As(err, &actionErr)
+	return MessageError{WebsocketMessage: WebsocketMessage{Type: MessageTypeError}, Error: *actionErr}
+}
+
+func (m MessageError) Deserialize() (escoba.ActionError, error) {
+	return m.Error, nil
+}
+
 type MessageGimmeGameState struct {
 	WebsocketMessage
 }
@@ -76,3 +114,13 @@ func NewMessageAction(action escoba.Action) (MessageAction, error) {
 func (a MessageAction) Deserialize() (escoba.Action, error) {
 	return escoba.DeserializeAction(a.Action)
 }
+
+// MessageTakeback asks to undo the last action. The server only undoes it once
+// both players have asked for it, and only if the game allows takebacks.
+type MessageTakeback struct {
+	WebsocketMessage
+}
+
+func NewMessageTakeback() MessageTakeback {
+	return MessageTakeback{WebsocketMessage: WebsocketMessage{Type: MessageTypeTakeback}}
+}
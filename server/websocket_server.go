@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"log"
 	"net/http"
+	"sync"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
@@ -16,15 +17,49 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
-// TODO: resources shouldn't be shared between goroutines! It's not panicking due to insufficient testing for now.
+// server runs a match for players connected over WebSockets. Every player has
+// their own goroutine, and any of them may change the match (e.g. with actions
+// run out of turn), so they all take turns through mu.
 type server struct {
-	gameState *escoba.GameState
-	port      string
-	players   []*websocket.Conn
+	match   *escoba.Match
+	port    string
+	players []*websocket.Conn
+
+	// takebackRequests holds the players who asked to undo the last action.
+	takebackRequests map[int]bool
+
+	// mu guards the match, players and takebackRequests, and the writes to the
+	// connections: it's held while handling a message, from checking the action
+	// to broadcasting the new state.
+	mu sync.Mutex
+
+	// debug makes the server validate the game after every change (see EnableDebug).
+	debug bool
 }
 
-func New(port string) *server {
-	return &server{gameState: escoba.New(), port: port, players: []*websocket.Conn{nil, nil}}
+// New creates a server for a game created with the given options, e.g.
+// escoba.WithTakebacks() to let the players agree to undo actions.
+func New(port string, opts ...func(*escoba.GameState)) *server {
+	return NewMatch(port, 1, opts...)
+}
+
+// NewMatch creates a server for a match of up to bestOf games, each created
+// with the given options (see escoba.NewMatch).
+func NewMatch(port string, bestOf int, opts ...func(*escoba.GameState)) *server {
+	opts = append(opts, escoba.WithObserver(escoba.ObserverFunc(logEvent)))
+	match := escoba.NewMatch(bestOf, opts...)
+	return &server{
+		match:            match,
+		port:             port,
+		players:          make([]*websocket.Conn, match.Game.Rules.Players),
+		takebackRequests: map[int]bool{},
+	}
+}
+
+// EnableDebug makes the server validate the game after every action and
+// takeback (see escoba.GameState.Validate), and log the invariants that don't hold.
+func (s *server) EnableDebug() {
+	s.debug = true
 }
 
 func (s *server) Start() {
@@ -48,29 +83,18 @@ func (s *server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if *playerID < 0 || *playerID > 1 {
-		log.Println("Invalid player ID")
-		return
-	}
-	if s.players[*playerID] != nil {
-		log.Println("Player already connected")
-		return
-	}
-	s.players[*playerID] = conn
-
-	msg, _ := NewMessageHeresGameState(*s.gameState)
-	if err := WsSend(conn, msg); err != nil {
-		log.Println(err)
+	if !s.connect(conn, *playerID) {
 		return
 	}
-	log.Println("Player", *playerID, "connected")
 
 	for {
 		log.Println("Waiting for action/state_request from player", *playerID)
 		_, message, err := conn.ReadMessage()
 		if err != nil {
 			log.Println("Failed to read message from client, freeing slot:", err)
+			s.mu.Lock()
 			s.players[*playerID] = nil
+			s.mu.Unlock()
 			break
 		}
 
@@ -80,39 +104,156 @@ func (s *server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 
-		switch wsMessage.Type {
-		case MessageTypeAction:
-			log.Println("Got action message:", string(message))
-			action, err := WsDeserializeMessage[escoba.Action, MessageAction](message, MessageTypeAction)
-			if err != nil {
+		s.mu.Lock()
+		ok := s.handleMessage(conn, *playerID, wsMessage.Type, message)
+		s.mu.Unlock()
+		if !ok {
+			return
+		}
+	}
+}
+
+// connect seats conn as playerID and sends them the match, or returns false if
+// the seat doesn't exist or is taken.
+func (s *server) connect(conn *websocket.Conn, playerID int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if playerID < 0 || playerID >= len(s.players) {
+		log.Println("Invalid player ID")
+		return false
+	}
+	if s.players[playerID] != nil {
+		log.Println("Player already connected")
+		return false
+	}
+	s.players[playerID] = conn
+
+	msg, _ := NewMessageHeresMatch(s.match.ViewFor(playerID))
+	if err := WsSend(conn, msg); err != nil {
+		log.Println(err)
+		s.players[playerID] = nil
+		return false
+	}
+	log.Println("Player", playerID, "connected")
+	if s.match.Game.Rules.Teams {
+		log.Println("Player", playerID, "plays for team", s.match.Game.TeamOf(playerID), "with player", s.match.Game.PartnerOf(playerID))
+	}
+	return true
+}
+
+// handleMessage handles a message from playerID, and returns false if the
+// connection must be closed. It must be called with s.mu held.
+func (s *server) handleMessage(conn *websocket.Conn, playerID int, messageType int, message []byte) bool {
+	switch messageType {
+	case MessageTypeAction:
+		log.Println("Got action message:", string(message))
+		action, err := WsDeserializeMessage[escoba.Action, MessageAction](message, MessageTypeAction)
+		if err == nil {
+			err = s.match.Game.CheckAction(playerID, *action)
+		}
+		if err == nil {
+			err = s.match.RunAction(*action)
+		}
+		if err != nil {
+			log.Println("Failed to run action:", err)
+			if err := WsSend(conn, NewMessageError(err)); err != nil {
 				log.Println(err)
-				return
-			}
-			err = s.gameState.RunAction(*action)
-			if err != nil {
-				// TODO write back to the connection
-				log.Println("Failed to run action:", err)
-				break
+				return false
 			}
+			break
+		}
 
-			log.Println("Ran action message:", string(message))
+		log.Println("Ran action message:", string(message))
+		s.takebackRequests = map[int]bool{}
+		s.validateGame()
 
-			msg, _ := NewMessageHeresGameState(*s.gameState)
-			for i, playerConn := range s.players {
-				log.Println("Sending game state to player", i)
-				if err := WsSend(playerConn, msg); err != nil {
-					log.Println(err)
-					return
-				}
-			}
-		case MessageTypeGimmeGameState:
-			log.Println("Got state request message:", string(message))
+		if err := s.broadcastGameState(); err != nil {
+			log.Println(err)
+			return false
+		}
 
-			msg, _ := NewMessageHeresGameState(*s.gameState)
-			if err := WsSend(conn, msg); err != nil {
+		// Show the end of the game to everyone before starting the next one
+		if s.match.Game.IsEnded && !s.match.IsEnded {
+			log.Println("Game", s.match.GameNumber, "of the match ended, starting the next one")
+			if err := s.match.NextGame(); err != nil {
+				log.Println("Failed to start the next game:", err)
+				break
+			}
+			if err := s.broadcastGameState(); err != nil {
 				log.Println(err)
-				return
+				return false
 			}
 		}
+	case MessageTypeGimmeGameState:
+		log.Println("Got state request message:", string(message))
+
+		msg, _ := NewMessageHeresGameState(s.match.Game.ViewFor(playerID))
+		if err := WsSend(conn, msg); err != nil {
+			log.Println(err)
+			return false
+		}
+	case MessageTypeTakeback:
+		log.Println("Got takeback message from player", playerID)
+		if !s.match.Game.TakebacksAllowed {
+			log.Println("Takebacks are not allowed in this game")
+			break
+		}
+		if s.match.Game.IsEnded {
+			log.Println("Can't take back actions of an ended game")
+			break
+		}
+		s.takebackRequests[playerID] = true
+		if len(s.takebackRequests) < len(s.players) {
+			break
+		}
+		s.takebackRequests = map[int]bool{}
+
+		if err := s.match.Game.Undo(); err != nil {
+			log.Println("Failed to undo action:", err)
+			break
+		}
+		s.validateGame()
+		if err := s.broadcastGameState(); err != nil {
+			log.Println(err)
+			return false
+		}
+	}
+	return true
+}
+
+// validateGame logs the invariants of the current game that don't hold, in debug mode
+func (s *server) validateGame() {
+	if !s.debug {
+		return
+	}
+	if err := s.match.Game.Validate(); err != nil {
+		log.Println("Invalid game state:", err)
+	}
+}
+
+// logEvent logs the highlights of the game
+func logEvent(event escoba.Event) {
+	switch event.Type {
+	case escoba.EVENT_ESCOBA, escoba.EVENT_INITIAL_ESCOBA:
+		log.Println("Player", event.PlayerID, "made an escoba")
+	case escoba.EVENT_SET_SCORED:
+		log.Printf("Set %d scored:\n%v", event.SetNumber, event.SetResult)
+	case escoba.EVENT_GAME_ENDED:
+		log.Println("Game ended by", event.EndReason, "with winner", event.WinnerID)
+	}
+}
+
+// broadcastGameState sends each connected player their view of the match.
+func (s *server) broadcastGameState() error {
+	for i, playerConn := range s.players {
+		if playerConn == nil {
+			continue
+		}
+		log.Println("Sending game state to player", i)
+		msg, _ := NewMessageHeresMatch(s.match.ViewFor(i))
+		if err := WsSend(playerConn, msg); err != nil {
+			return err
+		}
 	}
+	return nil
 }